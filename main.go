@@ -21,6 +21,7 @@ import (
 
 var (
 	conf        = flag.String("conf", "config.yaml", "The config path file")
+	confWatch   = flag.Duration("conf-watch-interval", 10*time.Second, "How often the config file is checked for changes to reload it, 0 to only reload on SIGHUP.")
 	addr        = flag.String("metrics-address", ":2112", "The address to listen on for HTTP requests.")
 	kubeconfig  = flag.String("kubeconfig", "", "Path to the kubeconfig file to use.")
 	tlsConf     = flag.String("metrics-tls-config", "", "The TLS config file for your metrics.")
@@ -32,16 +33,10 @@ func main() {
 	flag.Parse()
 
 	log.Info().Msg("Reading config file " + *conf)
-	configBytes, err := os.ReadFile(*conf)
+	// The config is loaded like on every reload
+	cfg, err := setup.LoadConfig(*conf)
 	if err != nil {
-		log.Fatal().Err(err).Msg("cannot read config file")
-	}
-
-	configBytes = []byte(os.ExpandEnv(string(configBytes)))
-
-	cfg, err := setup.ParseConfigFromBytes(configBytes)
-	if err != nil {
-		log.Fatal().Msg(err.Error())
+		log.Fatal().Err(err).Msg("cannot load config file")
 	}
 
 	if cfg.LogLevel != "" {
@@ -100,14 +95,8 @@ func main() {
 		}()
 	}
 
-	cfg.SetDefaults()
-
 	log.Info().Msgf("Starting with config: %#v", cfg)
 
-	if err := cfg.Validate(); err != nil {
-		log.Fatal().Err(err).Msg("config validation failed")
-	}
-
 	kubecfg, err := kube.GetKubernetesConfig(*kubeconfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot get kubeconfig")
@@ -118,7 +107,26 @@ func main() {
 	metrics.Init(*addr, *tlsConf, cfg.LogLevel)
 	metricsStore := metrics.NewMetricsStore(cfg.MetricsNamePrefix)
 
-	engine := exporter.NewEngine(&cfg, &exporter.ChannelBasedReceiverRegistry{MetricsStore: metricsStore})
+	registry := &exporter.ChannelBasedReceiverRegistry{MetricsStore: metricsStore}
+	metrics.AddReadinessCheck(registry.Ready)
+	engine := exporter.NewEngine(&cfg, registry)
+	engine.SetMetricsStore(metricsStore)
+	if cfg.SilencesAPI.Token != "" {
+		// Served by the metrics server, which uses the default mux
+		silences := engine.Silences.Handler(cfg.SilencesAPI.Token)
+		http.Handle(exporter.SilencesPath, silences)
+		http.Handle(exporter.SilencesPath+"/", silences)
+		log.Info().Str("path", exporter.SilencesPath).Msg("Silences API enabled")
+	}
+	if engine.Traces != nil {
+		// The traces hold the messages of the events, they are only served with the token of the silences API
+		if cfg.SilencesAPI.Token != "" {
+			http.Handle(exporter.RoutesPath, engine.Traces.Handler(cfg.SilencesAPI.Token))
+			log.Info().Str("path", exporter.RoutesPath).Int("size", cfg.RouteTraces).Msg("Routing traces enabled")
+		} else {
+			log.Warn().Str("path", exporter.RoutesPath).Msg("Routing traces are not served, silencesAPI.token is not set")
+		}
+	}
 	onEvent := engine.OnEvent
 	if cfg.ClusterName != "" {
 		onEvent = func(event *kube.EnhancedEvent) {
@@ -138,6 +146,8 @@ func main() {
 		kube.WithOnEventHandler(onEvent),
 		kube.WithNamespace(cfg.Namespace),
 		kube.WithOmitLookup(cfg.OmitLookup),
+		kube.WithResolveOwners(cfg.ResolveOwners),
+		kube.WithNamespaceMetadata(cfg.NamespaceMetadata),
 	)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot create EventWatcherRequired")
@@ -155,6 +165,14 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	watcher := &setup.ConfigWatcher{
+		Engine:       engine,
+		MetricsStore: metricsStore,
+		Path:         *conf,
+		Interval:     *confWatch,
+	}
+	go watcher.Run(ctx)
+
 	if cfg.LeaderElection.Enabled {
 		var wasLeader bool
 		log.Info().Msg("leader election enabled")
@@ -2,69 +2,155 @@ package batch
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+)
+
+const (
+	DefaultBaseBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+	// DefaultQueueSizeFactor sizes the intake queue to this many batches by default
+	DefaultQueueSizeFactor = 10
+)
+
+// Reasons of the dropped items, they label the dropped items metric
+const (
+	DropQueueFull      = "queueFull"
+	DropMaxRetries     = "maxRetries"
+	DropRetryQueueFull = "retryQueueFull"
+	DropStopped        = "stopped"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the intake queue cannot take all the items
+	ErrQueueFull = errors.New("batch writer queue is full")
+	// ErrStopped is returned by Submit once the writer is stopped
+	ErrStopped = errors.New("batch writer is stopped")
 )
 
-// Writer allows to buffer some items and call the Handler function either when the buffer is full or the timeout is
-// reached. There will also be support for concurrency for high volume. The handler function is supposed to return an
-// array of booleans to indicate whether the transfer was successful or not. It can be replaced with status codes in
-// the future to differentiate I/O errors, rate limiting, authorization issues.
-type Writer struct {
-	Handler  Callback
-	done     chan bool
-	stopDone chan bool
-	items    chan any
-	buffer   []bufferItem
+// Writer allows to buffer some items and call the Handler function either when the buffer is full or the interval
+// is reached. The handler function is supposed to return an array of booleans to indicate whether the transfer of
+// every item was successful or not.
+// Failed items wait in a bounded retry queue, apart from the fresh items, and are handed to the handler again after
+// an exponential backoff until MaxRetries is reached. Submit never blocks: items which do not fit in the intake
+// queue are rejected, so the caller notices the back-pressure.
+type Writer[T any] struct {
+	Handler  Callback[T]
+	metrics  atomic.Pointer[writerMetrics]
+	done     chan struct{}
+	stopDone chan struct{}
+	flush    chan flushRequest
+	items    chan T
+	buffer   []T
+	retries  []retryItem[T]
 	cfg      WriterConfig
-	len      int
+	// pending counts the submitted items which are neither delivered nor dropped yet
+	pending atomic.Int64
+	// mu makes Stop wait for the Submit calls in progress, so no item is queued once the writer loop drained the
+	// intake queue
+	mu      sync.RWMutex
+	stopped bool
 }
 
-type bufferItem struct {
-	v       any
+type retryItem[T any] struct {
+	due     time.Time
+	v       T
 	attempt int
 }
 
-type Callback func(ctx context.Context, items []any) []bool
+// writerMetrics is the metrics store the writer reports to, with the name labeling its metrics
+type writerMetrics struct {
+	store *metrics.Store
+	name  string
+}
+
+// flushRequest asks the writer loop to process the buffer until it is empty or ctx is done, the number of items
+// left in the buffer is sent to result
+type flushRequest struct {
+	ctx    context.Context
+	result chan int
+}
+
+// Callback hands a batch to its destination, it returns whether every item was delivered
+type Callback[T any] func(ctx context.Context, items []T) []bool
 
 type WriterConfig struct {
 	BatchSize  int
 	MaxRetries int
 	Interval   time.Duration
-	Timeout    time.Duration
+	// Timeout bounds every call of the handler, zero means no limit
+	Timeout time.Duration
+	// BaseBackoff is the delay before the first retry of a failed item, it is doubled for every further retry up to
+	// MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// QueueSize bounds the submitted items which wait to be buffered
+	QueueSize int
+	// RetryQueueSize bounds the failed items which wait for a retry, the oldest ones are dropped beyond it
+	RetryQueueSize int
+}
+
+func (c *WriterConfig) SetDefaults() {
+	c.BatchSize = max(c.BatchSize, 1)
+	if c.BaseBackoff == 0 {
+		c.BaseBackoff = DefaultBaseBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = max(DefaultMaxBackoff, c.BaseBackoff)
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = c.BatchSize * DefaultQueueSizeFactor
+	}
+	if c.RetryQueueSize == 0 {
+		c.RetryQueueSize = c.QueueSize
+	}
 }
 
-func NewWriter(cfg WriterConfig, cb Callback) *Writer {
-	return &Writer{
+func NewWriter[T any](cfg WriterConfig, cb Callback[T]) *Writer[T] {
+	cfg.SetDefaults()
+	return &Writer[T]{
 		cfg:     cfg,
 		Handler: cb,
-		buffer:  make([]bufferItem, cfg.BatchSize),
+		buffer:  make([]T, 0, cfg.BatchSize),
 	}
 }
 
+// SetMetrics makes the writer report its flushes, batch sizes, retries and drops to the store, labeled by name.
+// It can be called at any time.
+func (w *Writer[T]) SetMetrics(store *metrics.Store, name string) {
+	w.metrics.Store(&writerMetrics{store: store, name: name})
+}
+
 // Indicates the start to accept the
-func (w *Writer) Start() {
-	w.done = make(chan bool)
-	w.items = make(chan any)
-	w.stopDone = make(chan bool)
+func (w *Writer[T]) Start() {
+	w.done = make(chan struct{})
+	w.items = make(chan T, w.cfg.QueueSize)
+	w.stopDone = make(chan struct{})
+	w.flush = make(chan flushRequest)
 	ticker := time.NewTicker(w.cfg.Interval)
 
 	go func() {
-		shouldGoOn := true
-		for shouldGoOn {
+		defer close(w.stopDone)
+		defer ticker.Stop()
+		for {
 			select {
 			case item := <-w.items:
-				if w.len >= w.cfg.BatchSize {
-					w.processBuffer(context.Background())
-					w.len = 0
-				}
-
-				w.buffer[w.len] = bufferItem{v: item, attempt: 0}
-				w.len++
+				w.add(item)
 			case <-w.done:
+				w.drainIntake()
 				w.processBuffer(context.Background())
-				shouldGoOn = false
-				w.stopDone <- true
-				ticker.Stop()
+				if n := len(w.buffer) + len(w.retries); n > 0 {
+					w.dropped(DropStopped, n)
+					w.pending.Add(-int64(n))
+				}
+				return
+			case req := <-w.flush:
+				req.result <- w.flushAll(req.ctx)
 			case <-ticker.C:
 				w.processBuffer(context.Background())
 			}
@@ -72,53 +158,195 @@ func (w *Writer) Start() {
 	}()
 }
 
-func (w *Writer) processBuffer(ctx context.Context) {
-	if w.len == 0 {
-		return
+// add buffers a fresh item, and sends the buffer once it is full
+func (w *Writer[T]) add(item T) {
+	w.buffer = append(w.buffer, item)
+	if len(w.buffer) >= w.cfg.BatchSize {
+		w.send(context.Background(), w.buffer, nil)
+		w.buffer = w.buffer[:0]
 	}
+}
 
-	// Need to copy the underlying item to another slice
-	slice := make([]any, w.len)
-	for i := 0; i < w.len; i++ {
-		slice[i] = w.buffer[i].v
+// drainIntake buffers the items which were submitted so far
+func (w *Writer[T]) drainIntake() {
+	for {
+		select {
+		case item := <-w.items:
+			w.add(item)
+		default:
+			return
+		}
 	}
+}
 
-	// Call the actual method
-	responses := w.Handler(ctx, slice)
-
-	// Overwriting buffer here. Since the newItemsCount will always be equal to or smaller than buffer, it's safe to
-	// overwrite the existing items whilst traversing the items.
-	var newItemsCount int
-	for idx, success := range responses {
-		if !success {
-			item := w.buffer[idx]
-			if item.attempt >= w.cfg.MaxRetries {
-				// It's dropped, sorry you asked for it
-				continue
+// flushAll processes the buffer and the retries until both are empty or ctx is done, waiting for the backoff of
+// the retries in between. It returns the number of items left.
+func (w *Writer[T]) flushAll(ctx context.Context) int {
+	w.drainIntake()
+	for ctx.Err() == nil {
+		w.processBuffer(ctx)
+		if len(w.buffer) == 0 && len(w.retries) == 0 {
+			break
+		}
+		next := w.retries[0].due
+		for _, r := range w.retries {
+			if r.due.Before(next) {
+				next = r.due
 			}
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+	return len(w.buffer) + len(w.retries)
+}
 
-			w.buffer[newItemsCount] = bufferItem{
-				v:       item.v,
-				attempt: item.attempt + 1,
-			}
+// processBuffer sends the retries which are due, then the fresh items
+func (w *Writer[T]) processBuffer(ctx context.Context) {
+	now := time.Now()
+	var due []retryItem[T]
+	pending := w.retries[:0]
+	for _, r := range w.retries {
+		if !r.due.After(now) && len(due) < w.cfg.BatchSize {
+			due = append(due, r)
+		} else {
+			pending = append(pending, r)
+		}
+	}
+	w.retries = pending
 
-			newItemsCount++
+	if len(due) > 0 {
+		items := make([]T, len(due))
+		attempts := make([]int, len(due))
+		for i, r := range due {
+			items[i] = r.v
+			attempts[i] = r.attempt
+		}
+		w.send(ctx, items, attempts)
+	}
+	if len(w.buffer) > 0 {
+		w.send(ctx, w.buffer, nil)
+		w.buffer = w.buffer[:0]
+	}
+}
+
+// send calls the handler with the items, bounded by the timeout. The failed items are queued for a retry unless
+// they reached the max retries, attempts holds the number of retries of every item so far, nil for fresh items.
+func (w *Writer[T]) send(ctx context.Context, items []T, attempts []int) {
+	// Need to copy the items, as the buffer is reused
+	batch := make([]T, len(items))
+	copy(batch, items)
+
+	if w.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.cfg.Timeout)
+		defer cancel()
+	}
+	responses := w.Handler(ctx, batch)
+	if m := w.metrics.Load(); m != nil {
+		m.store.BatchFlushes.WithLabelValues(m.name).Inc()
+		m.store.BatchSize.WithLabelValues(m.name).Observe(float64(len(batch)))
+	}
+
+	retried := 0
+	defer func() { w.pending.Add(-int64(len(batch) - retried)) }()
+	for idx, item := range batch {
+		// A missing response means the item was not delivered
+		if idx < len(responses) && responses[idx] {
+			continue
+		}
+		attempt := 0
+		if attempts != nil {
+			attempt = attempts[idx]
 		}
+		if attempt >= w.cfg.MaxRetries {
+			// It's dropped, sorry you asked for it
+			w.dropped(DropMaxRetries, 1)
+			continue
+		}
+		if len(w.retries) >= w.cfg.RetryQueueSize {
+			w.retries = w.retries[1:]
+			w.dropped(DropRetryQueueFull, 1)
+			w.pending.Add(-1)
+		}
+		w.retries = append(w.retries, retryItem[T]{
+			v:       item,
+			attempt: attempt + 1,
+			due:     time.Now().Add(w.backoff(attempt + 1)),
+		})
+		retried++
+	}
+	if m := w.metrics.Load(); m != nil && retried > 0 {
+		m.store.BatchRetries.WithLabelValues(m.name).Add(float64(retried))
+	}
+}
+
+// backoff returns the delay before the given retry
+func (w *Writer[T]) backoff(retry int) time.Duration {
+	d := w.cfg.BaseBackoff
+	for i := 1; i < retry && d < w.cfg.MaxBackoff; i++ {
+		d *= 2
 	}
+	return min(d, w.cfg.MaxBackoff)
+}
 
-	w.len = newItemsCount
-	// TODO(makin) an edge case, if all items fail, and the buffer is full, new item cannot be added to buffer.
+func (w *Writer[T]) dropped(reason string, n int) {
+	if m := w.metrics.Load(); m != nil {
+		m.store.BatchDropped.WithLabelValues(m.name, reason).Add(float64(n))
+	}
 }
 
-// Used to signal writer to stop processing items and exit.
-func (w *Writer) Stop() {
-	w.done <- true
+// Flush processes the buffered items, including the retries of the failed ones, until the buffer is empty or ctx
+// is done. It returns the number of items left in the buffer. When ctx is done before the writer picks up the
+// request, it returns the number of submitted items which are not delivered yet, including the items in flight.
+func (w *Writer[T]) Flush(ctx context.Context) int {
+	req := flushRequest{ctx: ctx, result: make(chan int, 1)}
+	select {
+	case w.flush <- req:
+	case <-ctx.Done():
+		return int(max(w.pending.Load(), 0))
+	case <-w.stopDone:
+		return 0
+	}
+	return <-req.result
+}
+
+// Used to signal writer to stop processing items and exit. The items which are not delivered by a last flush
+// are dropped.
+func (w *Writer[T]) Stop() {
+	w.mu.Lock()
+	stopped := w.stopped
+	w.stopped = true
+	w.mu.Unlock()
+	if stopped {
+		return
+	}
+	close(w.done)
 	<-w.stopDone
 }
 
-// Submit pushes the items to the income buffer and they are placed onto the actual buffer from there.
-func (w *Writer) Submit(items ...any) {
-	for _, item := range items {
-		w.items <- item
+// Submit pushes the items to the intake queue and they are placed onto the actual buffer from there. It never
+// blocks: when the queue is full, the remaining items are dropped and ErrQueueFull is returned. Once the writer is
+// stopped, the items are dropped and ErrStopped is returned.
+func (w *Writer[T]) Submit(items ...T) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.stopped {
+		w.dropped(DropStopped, len(items))
+		return ErrStopped
+	}
+	w.pending.Add(int64(len(items)))
+	for i, item := range items {
+		select {
+		case w.items <- item:
+		default:
+			w.dropped(DropQueueFull, len(items)-i)
+			w.pending.Add(-int64(len(items) - i))
+			return fmt.Errorf("%w: dropped %d of %d items", ErrQueueFull, len(items)-i, len(items))
+		}
 	}
+	return nil
 }
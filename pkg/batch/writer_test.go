@@ -2,11 +2,36 @@ package batch
 
 import (
 	"context"
-	"github.com/stretchr/testify/assert"
+	"fmt"
+	"slices"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// batchRecorder records the batches passed to a handler, which runs in the writer loop
+type batchRecorder struct {
+	recorded [][]int
+	mu       sync.Mutex
+}
+
+func (r *batchRecorder) record(items []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorded = append(r.recorded, items)
+}
+
+func (r *batchRecorder) batches() [][]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.recorded)
+}
+
 func TestSimpleWriter(t *testing.T) {
 	cfg := WriterConfig{
 		BatchSize:  10,
@@ -14,8 +39,8 @@ func TestSimpleWriter(t *testing.T) {
 		Interval:   time.Second * 2,
 	}
 
-	var allItems []any
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	var allItems []int
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = true
@@ -50,8 +75,8 @@ func TestLargerThanBatchSize(t *testing.T) {
 		Interval:   time.Second * 2,
 	}
 
-	allItems := make([][]any, 0)
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	allItems := make([][]int, 0)
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = true
@@ -66,9 +91,9 @@ func TestLargerThanBatchSize(t *testing.T) {
 	w.Stop()
 
 	assert.Len(t, allItems, 3)
-	assert.Equal(t, allItems[0], []any{1, 2, 3})
-	assert.Equal(t, allItems[1], []any{4, 5, 6})
-	assert.Equal(t, allItems[2], []any{7})
+	assert.Equal(t, allItems[0], []int{1, 2, 3})
+	assert.Equal(t, allItems[1], []int{4, 5, 6})
+	assert.Equal(t, allItems[2], []int{7})
 }
 
 func TestSimpleInterval(t *testing.T) {
@@ -78,28 +103,28 @@ func TestSimpleInterval(t *testing.T) {
 		Interval:   time.Millisecond * 20,
 	}
 
-	allItems := make([][]any, 0)
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	var recorded batchRecorder
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = true
 		}
 
-		allItems = append(allItems, items)
+		recorded.record(items)
 		return resp
 	})
 
 	w.Start()
 	w.Submit(1, 2)
 	time.Sleep(time.Millisecond * 5)
-	assert.Len(t, allItems, 0)
+	assert.Len(t, recorded.batches(), 0)
 
 	time.Sleep(time.Millisecond * 50)
-	assert.Len(t, allItems, 1)
-	assert.Equal(t, allItems[0], []any{1, 2})
+	assert.Len(t, recorded.batches(), 1)
+	assert.Equal(t, recorded.batches()[0], []int{1, 2})
 
 	w.Stop()
-	assert.Len(t, allItems, 1)
+	assert.Len(t, recorded.batches(), 1)
 }
 
 func TestIntervalComplex(t *testing.T) {
@@ -109,14 +134,14 @@ func TestIntervalComplex(t *testing.T) {
 		Interval:   time.Millisecond * 20,
 	}
 
-	allItems := make([][]any, 0)
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	var recorded batchRecorder
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = true
 		}
 
-		allItems = append(allItems, items)
+		recorded.record(items)
 		return resp
 	})
 
@@ -124,14 +149,14 @@ func TestIntervalComplex(t *testing.T) {
 	w.Submit(1, 2)
 	time.Sleep(time.Millisecond * 5)
 	w.Submit(3, 4)
-	assert.Len(t, allItems, 0)
+	assert.Len(t, recorded.batches(), 0)
 
 	time.Sleep(time.Millisecond * 50)
-	assert.Len(t, allItems, 1)
-	assert.Equal(t, allItems[0], []any{1, 2, 3, 4})
+	assert.Len(t, recorded.batches(), 1)
+	assert.Equal(t, recorded.batches()[0], []int{1, 2, 3, 4})
 
 	w.Stop()
-	assert.Len(t, allItems, 1)
+	assert.Len(t, recorded.batches(), 1)
 }
 
 func TestIntervalComplexAfterFlush(t *testing.T) {
@@ -141,14 +166,14 @@ func TestIntervalComplexAfterFlush(t *testing.T) {
 		Interval:   time.Millisecond * 20,
 	}
 
-	allItems := make([][]any, 0)
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	var recorded batchRecorder
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = true
 		}
 
-		allItems = append(allItems, items)
+		recorded.record(items)
 		return resp
 	})
 
@@ -156,46 +181,233 @@ func TestIntervalComplexAfterFlush(t *testing.T) {
 	w.Submit(1, 2)
 	time.Sleep(time.Millisecond * 5)
 	w.Submit(3, 4)
-	assert.Len(t, allItems, 0)
+	assert.Len(t, recorded.batches(), 0)
 
 	time.Sleep(time.Millisecond * 50)
-	assert.Len(t, allItems, 1)
-	assert.Equal(t, allItems[0], []any{1, 2, 3, 4})
+	assert.Len(t, recorded.batches(), 1)
+	assert.Equal(t, recorded.batches()[0], []int{1, 2, 3, 4})
 
 	w.Submit(5, 6, 7)
 	w.Stop()
 
-	assert.Len(t, allItems, 2)
-	assert.Equal(t, allItems[1], []any{5, 6, 7})
+	assert.Len(t, recorded.batches(), 2)
+	assert.Equal(t, recorded.batches()[1], []int{5, 6, 7})
 }
 
 func TestRetry(t *testing.T) {
 	cfg := WriterConfig{
-		BatchSize:  5,
-		MaxRetries: 3,
-		Interval:   time.Millisecond * 10,
+		BatchSize:   5,
+		MaxRetries:  3,
+		Interval:    time.Millisecond * 10,
+		BaseBackoff: time.Millisecond * 10,
+		MaxBackoff:  time.Millisecond * 40,
 	}
 
-	allItems := make([][]any, 0)
-	w := NewWriter(cfg, func(ctx context.Context, items []any) []bool {
+	var recorded batchRecorder
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
 		resp := make([]bool, len(items))
 		for idx := range resp {
 			resp[idx] = items[idx] != 2
 		}
 
-		allItems = append(allItems, items)
+		recorded.record(items)
 		return resp
 	})
 
 	w.Start()
 	w.Submit(1, 2, 3)
-	assert.Len(t, allItems, 0)
+	assert.Len(t, recorded.batches(), 0)
 
 	time.Sleep(time.Millisecond * 200)
-	assert.Len(t, allItems, 4)
+	assert.Len(t, recorded.batches(), 4)
+
+	assert.Equal(t, recorded.batches()[0], []int{1, 2, 3})
+	assert.Equal(t, recorded.batches()[1], []int{2})
+	assert.Equal(t, recorded.batches()[2], []int{2})
+	assert.Equal(t, recorded.batches()[3], []int{2})
+}
+
+func TestFlushRetriesUntilEmpty(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize:   10,
+		MaxRetries:  3,
+		Interval:    time.Hour,
+		BaseBackoff: time.Millisecond,
+	}
+
+	calls := 0
+	var delivered []int
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		calls++
+		resp := make([]bool, len(items))
+		// Fail the first call, so the items have to be retried
+		if calls > 1 {
+			for idx := range resp {
+				resp[idx] = true
+			}
+			delivered = append(delivered, items...)
+		}
+		return resp
+	})
+
+	w.Start()
+	w.Submit(1, 2, 3)
+	assert.Equal(t, 0, w.Flush(context.Background()))
+	assert.Equal(t, []int{1, 2, 3}, delivered)
+	assert.Equal(t, 2, calls)
+	w.Stop()
+}
+
+func TestFlushStopsWhenContextIsDone(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize:   10,
+		MaxRetries:  1000,
+		Interval:    time.Hour,
+		BaseBackoff: time.Millisecond,
+	}
+
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		time.Sleep(5 * time.Millisecond)
+		return make([]bool, len(items))
+	})
+
+	w.Start()
+	w.Submit(1, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 2, w.Flush(ctx))
+	w.Stop()
+}
+
+func TestFlushCountsPendingItemsWhenContextIsDoneFirst(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize: 10,
+		Interval:  time.Hour,
+	}
+
+	called := make(chan struct{}, 1)
+	release := make(chan struct{})
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		called <- struct{}{}
+		<-release
+		resp := make([]bool, len(items))
+		for idx := range resp {
+			resp[idx] = true
+		}
+		return resp
+	})
+
+	// Block the writer loop in the handler, so it cannot pick up the flush request
+	w.Start()
+	require.NoError(t, w.Submit(1))
+	go w.Flush(context.Background())
+	<-called
+	require.NoError(t, w.Submit(2, 3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 3, w.Flush(ctx))
+
+	close(release)
+	assert.Equal(t, 0, w.Flush(context.Background()))
+	w.Stop()
+	assert.Equal(t, 0, w.Flush(context.Background()))
+}
+
+func TestHandlerContextHasTimeout(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize: 10,
+		Interval:  time.Hour,
+		Timeout:   time.Minute,
+	}
+
+	var deadline time.Time
+	var ok bool
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		deadline, ok = ctx.Deadline()
+		return []bool{true}
+	})
+
+	w.Start()
+	require.NoError(t, w.Submit(1))
+	assert.Equal(t, 0, w.Flush(context.Background()))
+	w.Stop()
+
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+func TestSubmitReportsBackPressure(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize: 10,
+		Interval:  time.Hour,
+		QueueSize: 2,
+	}
+
+	called := make(chan struct{}, 1)
+	release := make(chan struct{})
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		called <- struct{}{}
+		<-release
+		return make([]bool, len(items))
+	})
+	store := metrics.NewMetricsStore(fmt.Sprintf("%s_%d_", t.Name(), time.Now().UnixNano()))
+	defer metrics.DestroyMetricsStore(store)
+	w.SetMetrics(store, "bigquery")
+
+	// Block the writer loop in the handler, so the intake queue fills up
+	w.Start()
+	require.NoError(t, w.Submit(1))
+	go w.Flush(context.Background())
+	<-called
+
+	err := w.Submit(2, 3, 4)
+	require.ErrorIs(t, err, ErrQueueFull)
+	assert.InDelta(t, 1, testutil.ToFloat64(store.BatchDropped.WithLabelValues("bigquery", DropQueueFull)), 0)
+
+	close(release)
+	w.Stop()
+	assert.ErrorIs(t, w.Submit(5), ErrStopped)
+	assert.InDelta(t, 1, testutil.ToFloat64(store.BatchDropped.WithLabelValues("bigquery", DropStopped)), 0)
+}
+
+func TestFailedItemsDoNotBlockIntake(t *testing.T) {
+	cfg := WriterConfig{
+		BatchSize:      2,
+		MaxRetries:     3,
+		Interval:       time.Hour,
+		BaseBackoff:    time.Hour,
+		RetryQueueSize: 3,
+	}
+
+	var batches [][]int
+	w := NewWriter(cfg, func(ctx context.Context, items []int) []bool {
+		batches = append(batches, items)
+		return make([]bool, len(items))
+	})
+	store := metrics.NewMetricsStore(fmt.Sprintf("%s_%d_", t.Name(), time.Now().UnixNano()))
+	defer metrics.DestroyMetricsStore(store)
+	w.SetMetrics(store, "bigquery")
+
+	w.Start()
+	require.NoError(t, w.Submit(1, 2, 3, 4))
+	w.Stop()
+
+	// Every item failed, the fresh items are still sent and the retry queue drops the oldest failure
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}}, batches)
+	assert.InDelta(t, 2, testutil.ToFloat64(store.BatchFlushes.WithLabelValues("bigquery")), 0)
+	assert.InDelta(t, 4, testutil.ToFloat64(store.BatchRetries.WithLabelValues("bigquery")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(store.BatchDropped.WithLabelValues("bigquery", DropRetryQueueFull)), 0)
+	assert.InDelta(t, 3, testutil.ToFloat64(store.BatchDropped.WithLabelValues("bigquery", DropStopped)), 0)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	w := NewWriter(WriterConfig{BaseBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}, func(ctx context.Context, items []int) []bool {
+		return nil
+	})
 
-	assert.Equal(t, allItems[0], []any{1, 2, 3})
-	assert.Equal(t, allItems[1], []any{2})
-	assert.Equal(t, allItems[2], []any{2})
-	assert.Equal(t, allItems[3], []any{2})
+	assert.Equal(t, 10*time.Millisecond, w.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, w.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, w.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, w.backoff(4))
 }
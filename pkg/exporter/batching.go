@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/rs/zerolog/log"
+)
+
+// workBatches sends the events of a receiver queue to its batch sink until the queue is closed. A batch is sent
+// once it is full or its first event waited for the max latency.
+func (r *ChannelBasedReceiverRegistry) workBatches(rcv *receiver, q *eventQueue) {
+	for {
+		items := q.popBatch(rcv.batch.Size, rcv.batch.MaxLatency)
+		if len(items) == 0 {
+			return
+		}
+		r.MetricsStore.QueueDepth.WithLabelValues(rcv.name).Set(float64(rcv.queueLen()))
+
+		log.Debug().Str("sink", rcv.name).Int("events", len(items)).Msg("sending batch to sink")
+		firstAttempt := time.Now()
+		attempts, errs := r.deliverBatch(rcv, items)
+		for i := range items {
+			r.finish(rcv, items[i], attempts[i], firstAttempt, errs[i])
+		}
+	}
+}
+
+// deliverBatch sends the events to the batch sink of the receiver. After a partial failure, only the events which
+// failed with a retryable error are attempted again, as long as the retry configuration allows it. It returns the
+// number of attempts and the error of the last one for every event.
+func (r *ChannelBasedReceiverRegistry) deliverBatch(rcv *receiver, items []queuedEvent) ([]int, []error) {
+	ctx := rcv.ctx
+	maxAttempts := 1
+	if rcv.retry != nil {
+		maxAttempts = max(rcv.retry.MaxAttempts, 1)
+		if rcv.retry.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, rcv.retry.Deadline)
+			defer cancel()
+		}
+	}
+
+	attempts := make([]int, len(items))
+	errs := make([]error, len(items))
+	// pending holds the positions of the events to send in the next attempt
+	pending := make([]int, len(items))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for attempt := 1; ; attempt++ {
+		evs := make([]*kube.EnhancedEvent, len(pending))
+		for j, i := range pending {
+			ev := items[i].event
+			evs[j] = &ev
+		}
+		results := r.attemptBatch(ctx, rcv, evs)
+
+		var failed []int
+		var retryAfter time.Duration
+		for j, i := range pending {
+			attempts[i] = attempt
+			errs[i] = results[j]
+			if results[j] != nil && !sinks.IsPermanent(results[j]) {
+				failed = append(failed, i)
+				retryAfter = max(retryAfter, sinks.RetryAfter(results[j]))
+			}
+		}
+		if len(failed) == 0 || attempt >= maxAttempts {
+			return attempts, errs
+		}
+
+		wait := max(backoff(rcv.retry, attempt), retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return attempts, errs
+		}
+
+		log.Debug().Str("sink", rcv.name).Int("attempt", attempt).Int("events", len(failed)).Dur("backoff", wait).Msg("Cannot send events of the batch, retrying")
+		if sleep(ctx, wait) != nil {
+			return attempts, errs
+		}
+		r.MetricsStore.SendRetries.WithLabelValues(rcv.name).Add(float64(len(failed)))
+		pending = failed
+	}
+}
+
+// attemptBatch sends the events to the batch sink once, like attempt does for a single event. It returns one result
+// per event.
+func (r *ChannelBasedReceiverRegistry) attemptBatch(ctx context.Context, rcv *receiver, evs []*kube.EnhancedEvent) []error {
+	if err := rcv.limiter.waitN(ctx, len(evs)); err != nil {
+		return repeatError(len(evs), err)
+	}
+	if rcv.breaker != nil {
+		if ok, wait := rcv.breaker.allow(); !ok {
+			return repeatError(len(evs), sinks.Retryable(errCircuitOpen, wait))
+		}
+	}
+
+	if rcv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rcv.timeout)
+		defer cancel()
+	}
+	errs := rcv.batchSink.SendBatch(ctx, evs)
+	if len(errs) != len(evs) {
+		errs = repeatError(len(evs), fmt.Errorf("sink returned %d results for a batch of %d events", len(errs), len(evs)))
+	}
+	if rcv.breaker != nil {
+		rcv.breaker.record(batchError(errs))
+	}
+
+	var retryAfter time.Duration
+	rateLimited := false
+	for _, err := range errs {
+		if sinks.IsRateLimited(err) {
+			rateLimited = true
+			retryAfter = max(retryAfter, sinks.RetryAfter(err))
+		}
+	}
+	if rateLimited {
+		r.MetricsStore.SendRateLimited.WithLabelValues(rcv.name).Inc()
+		rcv.limiter.pause(retryAfter)
+	}
+	return errs
+}
+
+// batchError returns the error the circuit breaker accounts for a batch. The sink is only failing when none of the
+// events got through.
+func batchError(errs []error) error {
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+func repeatError(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
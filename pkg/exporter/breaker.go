@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerState is the state of a circuit breaker, its value is exported as the circuit breaker state metric
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// circuitBreaker stops the attempts to send to a sink which keeps failing. It opens after the configured number of
+// consecutive failures, and lets a single probe through once the probe interval passed. Enough successful probes
+// close it again, a failed one opens it for another interval.
+type circuitBreaker struct {
+	openedAt time.Time
+	// onChange is called with the new state whenever it changes
+	onChange  func(breakerState)
+	cfg       sinks.CircuitBreakerConfig
+	state     breakerState
+	failures  int
+	successes int
+	// probing is set while the probe of a half-open breaker is in flight
+	probing bool
+	mu      sync.Mutex
+}
+
+func newCircuitBreaker(cfg sinks.CircuitBreakerConfig, onChange func(breakerState)) *circuitBreaker {
+	cfg.SetDefaults()
+	return &circuitBreaker{cfg: cfg, onChange: onChange}
+}
+
+// allow reports whether an attempt can be made now. If not, it also returns how long until the next probe.
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.openedAt.Add(b.cfg.ProbeInterval)); wait > 0 {
+			return false, wait
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true, 0
+	case breakerHalfOpen:
+		if b.probing {
+			return false, 0
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// record accounts for the result of an allowed attempt. Permanent and rate-limited errors show that the sink is
+// reachable, so they do not count as failures.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := err != nil && !sinks.IsPermanent(err) && !sinks.IsRateLimited(err)
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.SuccessThreshold {
+			b.failures = 0
+			b.setState(breakerClosed)
+		}
+	case breakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	case breakerOpen:
+		// The attempt was allowed before another one opened the breaker
+	}
+}
+
+func (b *circuitBreaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.successes = 0
+	b.setState(breakerOpen)
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
@@ -0,0 +1,93 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var states []breakerState
+	b := newCircuitBreaker(sinks.CircuitBreakerConfig{FailureThreshold: 3, ProbeInterval: time.Hour}, func(s breakerState) {
+		states = append(states, s)
+	})
+	unavailable := errors.New("unavailable")
+
+	b.record(unavailable)
+	b.record(unavailable)
+	b.record(nil)
+	b.record(unavailable)
+	b.record(sinks.Permanent(errors.New("bad request")))
+	assert.Equal(t, breakerClosed, b.current())
+
+	for range 3 {
+		ok, _ := b.allow()
+		require.True(t, ok)
+		b.record(unavailable)
+	}
+	assert.Equal(t, breakerOpen, b.current())
+	assert.Equal(t, []breakerState{breakerOpen}, states)
+
+	ok, wait := b.allow()
+	assert.False(t, ok)
+	assert.Greater(t, wait, 59*time.Minute)
+}
+
+func TestCircuitBreaker_ProbesAfterInterval(t *testing.T) {
+	b := newCircuitBreaker(sinks.CircuitBreakerConfig{FailureThreshold: 1, SuccessThreshold: 2, ProbeInterval: 10 * time.Millisecond}, nil)
+	b.record(errors.New("unavailable"))
+	require.Equal(t, breakerOpen, b.current())
+
+	time.Sleep(15 * time.Millisecond)
+	ok, _ := b.allow()
+	require.True(t, ok)
+	assert.Equal(t, breakerHalfOpen, b.current())
+	// Only one probe is in flight at a time
+	ok, _ = b.allow()
+	assert.False(t, ok)
+
+	// A failed probe opens the breaker for another interval
+	b.record(errors.New("still unavailable"))
+	assert.Equal(t, breakerOpen, b.current())
+
+	time.Sleep(15 * time.Millisecond)
+	for range 2 {
+		ok, _ = b.allow()
+		require.True(t, ok)
+		b.record(nil)
+	}
+	assert.Equal(t, breakerClosed, b.current())
+}
+
+func TestChannelBasedReceiverRegistry_ReadyReportsOpenBreakers(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &recordingSink{err: errors.New("unavailable")}
+	reg.Register("opsgenie", sink, &sinks.ReceiverConfig{
+		Name:           "opsgenie",
+		CircuitBreaker: &sinks.CircuitBreakerConfig{FailureThreshold: 2, ProbeInterval: time.Hour},
+	})
+	assert.NoError(t, reg.Ready())
+
+	reg.SendEvent("opsgenie", eventWithMessage("first"))
+	reg.SendEvent("opsgenie", eventWithMessage("second"))
+	require.Eventually(t, func() bool {
+		return reg.Ready() != nil
+	}, time.Second, 5*time.Millisecond)
+	assert.EqualError(t, reg.Ready(), "circuit breaker not closed for receivers: opsgenie (open)")
+
+	// The sink is not called while the breaker is open
+	sink.mu.Lock()
+	sink.err = nil
+	sink.mu.Unlock()
+	reg.SendEvent("opsgenie", eventWithMessage("third"))
+	require.Eventually(t, func() bool {
+		return reg.receivers["opsgenie"].queueLen() == 0
+	}, time.Second, 5*time.Millisecond)
+	reg.Close(context.Background())
+	assert.Empty(t, sink.received())
+}
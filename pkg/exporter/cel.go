@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// celEvent is what the expressions of the rules are evaluated against as the variable event. Its fields are named
+// like in the JSON form of the event.
+type celEvent struct {
+	FirstTimestamp       time.Time         `cel:"firstTimestamp"`
+	LastTimestamp        time.Time         `cel:"lastTimestamp"`
+	EventTime            time.Time         `cel:"eventTime"`
+	Labels               map[string]string `cel:"labels"`
+	Annotations          map[string]string `cel:"annotations"`
+	NamespaceLabels      map[string]string `cel:"namespaceLabels"`
+	NamespaceAnnotations map[string]string `cel:"namespaceAnnotations"`
+	Fields               map[string]string `cel:"fields"`
+	Source               celSource         `cel:"source"`
+	InvolvedObject       celObject         `cel:"involvedObject"`
+	Namespace            string            `cel:"namespace"`
+	Name                 string            `cel:"name"`
+	Reason               string            `cel:"reason"`
+	Message              string            `cel:"message"`
+	Type                 string            `cel:"type"`
+	Action               string            `cel:"action"`
+	ClusterName          string            `cel:"clusterName"`
+	ReportingController  string            `cel:"reportingController"`
+	ReportingInstance    string            `cel:"reportingInstance"`
+	Count                int64             `cel:"count"`
+}
+
+type celSource struct {
+	Component string `cel:"component"`
+	Host      string `cel:"host"`
+}
+
+type celObject struct {
+	Labels          map[string]string `cel:"labels"`
+	Annotations     map[string]string `cel:"annotations"`
+	Kind            string            `cel:"kind"`
+	Name            string            `cel:"name"`
+	Namespace       string            `cel:"namespace"`
+	APIVersion      string            `cel:"apiVersion"`
+	UID             string            `cel:"uid"`
+	FieldPath       string            `cel:"fieldPath"`
+	OwnerReferences []celOwner        `cel:"ownerReferences"`
+	// Owner is the top owner when owners are resolved, otherwise the controller, it is empty without owner
+	Owner   celOwner `cel:"owner"`
+	Deleted bool     `cel:"deleted"`
+}
+
+type celOwner struct {
+	Kind       string `cel:"kind"`
+	Name       string `cel:"name"`
+	APIVersion string `cel:"apiVersion"`
+	UID        string `cel:"uid"`
+	Controller bool   `cel:"controller"`
+}
+
+func newCELEvent(ev *kube.EnhancedEvent) *celEvent {
+	c := &celEvent{
+		FirstTimestamp:       ev.FirstTimestamp.Time,
+		LastTimestamp:        ev.LastTimestamp.Time,
+		EventTime:            ev.EventTime.Time,
+		Labels:               ev.Labels,
+		Annotations:          ev.Annotations,
+		NamespaceLabels:      ev.NamespaceLabels,
+		NamespaceAnnotations: ev.NamespaceAnnotations,
+		Fields:               ev.Fields,
+		Source:               celSource{Component: ev.Source.Component, Host: ev.Source.Host},
+		Namespace:            ev.Namespace,
+		Name:                 ev.Name,
+		Reason:               ev.Reason,
+		Message:              ev.Message,
+		Type:                 ev.Type,
+		Action:               ev.Action,
+		ClusterName:          ev.ClusterName,
+		ReportingController:  ev.ReportingController,
+		ReportingInstance:    ev.ReportingInstance,
+		Count:                int64(ev.Count),
+		InvolvedObject: celObject{
+			Labels:      ev.InvolvedObject.Labels,
+			Annotations: ev.InvolvedObject.Annotations,
+			Kind:        ev.InvolvedObject.Kind,
+			Name:        ev.InvolvedObject.Name,
+			Namespace:   ev.InvolvedObject.Namespace,
+			APIVersion:  ev.InvolvedObject.APIVersion,
+			UID:         string(ev.InvolvedObject.UID),
+			FieldPath:   ev.InvolvedObject.FieldPath,
+			Deleted:     ev.InvolvedObject.Deleted,
+		},
+	}
+	for _, o := range ev.InvolvedObject.OwnerReferences {
+		c.InvolvedObject.OwnerReferences = append(c.InvolvedObject.OwnerReferences, newCELOwner(o))
+	}
+	c.InvolvedObject.Owner = newCELOwner(ev.InvolvedObject.Owner())
+	return c
+}
+
+func newCELOwner(o metav1.OwnerReference) celOwner {
+	return celOwner{
+		Kind:       o.Kind,
+		Name:       o.Name,
+		APIVersion: o.APIVersion,
+		UID:        string(o.UID),
+		Controller: o.Controller != nil && *o.Controller,
+	}
+}
+
+// celEnv returns the environment the expressions are compiled in, it is created once
+var celEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		ext.NativeTypes(reflect.TypeFor[celEvent](), ext.ParseStructTags(true)),
+		cel.Variable("event", cel.ObjectType("exporter.celEvent")),
+		ext.Strings(),
+	)
+})
+
+// compileCELExpression parses and type-checks a CEL expression, which must evaluate to a bool
+func compileCELExpression(expr string) (cel.Program, error) {
+	env, err := celEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("expression: %w", iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("expression must evaluate to a bool, got %s", ast.OutputType())
+	}
+	return env.Program(ast)
+}
+
+// matchesCELExpression evaluates the program against the event, an evaluation error does not match
+func matchesCELExpression(prg cel.Program, ev *kube.EnhancedEvent) (bool, error) {
+	out, _, err := prg.Eval(map[string]any{"event": newCELEvent(ev)})
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	return ok && matched, nil
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRule_Expression(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Count = 7
+	ev.Message = "Container was OOMKilled"
+	ev.LastTimestamp = metav1.NewTime(time.Now())
+	ev.InvolvedObject.Labels = map[string]string{"team": "payments"}
+	ev.InvolvedObject.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: "api"}}
+	ev.Fields = map[string]string{"exitCode": "137"}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`event.count > 5 && event.involvedObject.ownerReferences.exists(o, o.kind == "Deployment") && event.message.contains("OOM")`, true},
+		{`event.count > 10`, false},
+		{`event.involvedObject.owner.kind == "Deployment" && event.involvedObject.owner.name == "api"`, true},
+		{`event.involvedObject.labels["team"] == "payments"`, true},
+		{`"team" in event.involvedObject.annotations`, false},
+		{`int(event.fields["exitCode"]) == 137`, true},
+		{`event.lastTimestamp > timestamp("2020-01-01T00:00:00Z")`, true},
+		{`timestamp("2020-01-01T00:00:00Z") + duration("1h") > event.lastTimestamp`, false},
+		// A missing key is an evaluation error, which does not match
+		{`event.involvedObject.labels["app"] == "nginx"`, false},
+	}
+	for _, tt := range tests {
+		cfg := Config{Route: Route{Match: []Rule{{Expression: tt.expr}}}}
+		require.NoError(t, cfg.PreCompilePatterns(), tt.expr)
+		assert.Equal(t, tt.match, cfg.Route.Match[0].MatchesEvent(ev), tt.expr)
+
+		// Without precompiling, it falls back to runtime compilation
+		r := Rule{Expression: tt.expr}
+		assert.Equal(t, tt.match, r.MatchesEvent(ev), tt.expr)
+	}
+}
+
+func TestRule_ExpressionErrors(t *testing.T) {
+	tests := []struct {
+		route   Route
+		wantErr string
+	}{
+		{Route{Match: []Rule{{Expression: `event.count >`}}}, "route.match[0]: expression"},
+		{Route{Drop: []Rule{{}, {Expression: `event.unknown == 1`}}}, "route.drop[1]"},
+		{Route{Routes: []Route{{}, {Match: []Rule{{Expression: `event.count`}}}}}, "route.routes[1].match[0]: expression must evaluate to a bool"},
+		{Route{Match: []Rule{{Expression: `event.count == "7"`}}}, "no matching overload"},
+	}
+	for _, tt := range tests {
+		cfg := Config{Route: tt.route}
+		assert.ErrorContains(t, cfg.PreCompilePatterns(), tt.wantErr)
+	}
+}
@@ -2,80 +2,596 @@ package exporter
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/spool"
 	"github.com/rs/zerolog/log"
 )
 
-// ChannelBasedReceiverRegistry creates two channels for each receiver. One is for receiving events and other one is
-// for breaking out of the infinite loop. Each message is passed to receivers
-// This might not be the best way to implement such feature. A ring buffer can be better
-// and we might need a mechanism to drop the vents
-// On closing, the registry sends a signal on all exit channels, and then waits for all to complete.
+// ChannelBasedReceiverRegistry delivers the events of every receiver through bounded queues, each drained by a worker
+// sending the events to the sink according to the delivery settings of the receiver.
 type ChannelBasedReceiverRegistry struct {
-	ch           map[string]chan kube.EnhancedEvent
-	exitCh       map[string]chan any
+	receivers map[string]*receiver
+	// draining holds the replaced and unregistered receivers until they delivered their queued events
+	draining     []*receiver
 	wg           *sync.WaitGroup
 	MetricsStore *metrics.Store
+	// closing bounds the shutdown, it is set by Close
+	closing context.Context
+	mu      sync.RWMutex
+}
+
+// receiver holds the delivery state of a registered sink
+type receiver struct {
+	sink sinks.Sink
+	// queues holds one queue per worker, events are assigned to them by involved object
+	queues []*eventQueue
+	spool  *spool.Spool
+	// spoolDir is the directory of the spool, if any
+	spoolDir string
+	// keepSpool is set when the receiver which replaces this one took over its spool, which it must not close then.
+	// closingSpool is set once it is too late to take it over. Both are guarded by the registry lock.
+	keepSpool    bool
+	closingSpool bool
+	retry        *sinks.RetryConfig
+	limiter      *rateLimiter
+	// timeout bounds every attempt to send an event, zero means no limit
+	timeout time.Duration
+	// breaker is nil unless the receiver has a circuit breaker configured
+	breaker *circuitBreaker
+	// batchSink is nil unless batching is configured and the sink supports it
+	batchSink sinks.BatchSink
+	batch     sinks.BatchConfig
+	// dedup is nil unless the receiver has deduplication configured
+	dedup *deduplicator
+	// grouper is nil unless the receiver has grouping configured
+	grouper *grouper
+	// processors transform the events sent to the receiver
+	processors processorChain
+	// ctx is canceled when the shutdown timeout is reached, to interrupt the sends in flight and waiting for a retry
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed once the sink and spool are closed
+	done       chan struct{}
+	name       string
+	deadLetter string
+}
+
+// queueFor returns the queue of the worker responsible for the involved object of the event, so that the events of
+// an object are sent in order
+func (rcv *receiver) queueFor(ev *kube.EnhancedEvent) *eventQueue {
+	if len(rcv.queues) == 1 {
+		return rcv.queues[0]
+	}
+	key := string(ev.InvolvedObject.UID)
+	if key == "" {
+		key = ev.InvolvedObject.Namespace + "/" + ev.InvolvedObject.Name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	// The modulo is taken on the unsigned hash, which would turn negative as an int on 32-bit platforms
+	return rcv.queues[h.Sum32()%uint32(len(rcv.queues))] //nolint:gosec // there are far fewer queues than 2^32
+}
+
+// queueLen returns the number of events waiting in all queues of the receiver
+func (rcv *receiver) queueLen() int {
+	n := 0
+	for _, q := range rcv.queues {
+		n += q.len()
+	}
+	return n
+}
+
+// stopGrouping queues the pending notifications of the groups of the receiver, if it groups its events
+func (rcv *receiver) stopGrouping() {
+	if rcv.grouper != nil {
+		rcv.grouper.stop()
+	}
+}
+
+// stopping reports whether the shutdown timeout is reached
+func (rcv *receiver) stopping() bool {
+	return rcv.ctx.Err() != nil
+}
+
+// queuedEvent is an event waiting to be sent to a sink
+type queuedEvent struct {
+	event kube.EnhancedEvent
+	// seq is the position of the event in the receiver spool, zero if it is not spooled
+	seq uint64
 }
 
 func (r *ChannelBasedReceiverRegistry) SendEvent(name string, event *kube.EnhancedEvent) {
-	ch := r.ch[name]
-	if ch == nil {
-		log.Error().Str("name", name).Msg("There is no channel")
+	r.mu.RLock()
+	rcv := r.receivers[name]
+	r.mu.RUnlock()
+	// Dead letters are neither processed, deduplicated nor grouped, they are sent on by send directly
+	if rcv != nil {
+		event = rcv.processors.process(event)
 	}
+	if rcv != nil && rcv.dedup != nil {
+		if event = rcv.dedup.check(event); event == nil {
+			return
+		}
+	}
+	if rcv != nil && rcv.grouper != nil {
+		rcv.grouper.add(event)
+		return
+	}
+	r.send(name, event)
+}
 
-	go func() {
-		ch <- *event
-	}()
+// send spools and queues the event for the named receiver, and reports whether the receiver accepted it
+func (r *ChannelBasedReceiverRegistry) send(name string, event *kube.EnhancedEvent) bool {
+	r.mu.RLock()
+	rcv := r.receivers[name]
+	r.mu.RUnlock()
+	if rcv == nil {
+		log.Error().Str("name", name).Msg("There is no receiver")
+		return false
+	}
+	return r.sendTo(rcv, event)
 }
 
-func (r *ChannelBasedReceiverRegistry) Register(name string, receiver sinks.Sink) {
-	if r.ch == nil {
-		r.ch = make(map[string]chan kube.EnhancedEvent)
-		r.exitCh = make(map[string]chan any)
+// sendTo spools and queues the event for the receiver, and reports whether the receiver accepted it. A spooled event
+// is written to disk before it is queued, and replayed on the next start until its delivery is final.
+func (r *ChannelBasedReceiverRegistry) sendTo(rcv *receiver, event *kube.EnhancedEvent) bool {
+	name := rcv.name
+	item := queuedEvent{event: *event}
+	if rcv.spool != nil {
+		seq, err := rcv.spool.Append(event.ToJSON())
+		if err != nil {
+			log.Error().Err(err).Str("sink", name).Msg("Cannot write event to spool")
+		} else {
+			item.seq = seq
+			r.MetricsStore.SpoolDepth.WithLabelValues(name).Set(float64(rcv.spool.Depth()))
+		}
 	}
 
-	ch := make(chan kube.EnhancedEvent)
-	exitCh := make(chan any)
+	return r.enqueue(rcv, item)
+}
 
-	r.ch[name] = ch
-	r.exitCh[name] = exitCh
+// Register adds the receiver, or replaces the receiver registered under the same name, which first delivers the
+// events in its queues. It fails when the spool of the receiver cannot be opened.
+func (r *ChannelBasedReceiverRegistry) Register(name string, sink sinks.Sink, cfg *sinks.ReceiverConfig) error {
+	if cfg == nil {
+		cfg = &sinks.ReceiverConfig{Name: name}
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	rcv := &receiver{
+		ctx:        ctx,
+		cancel:     cancel,
+		name:       name,
+		sink:       sink,
+		queues:     newShardedQueues(cfg.Queue, cfg.Concurrency),
+		retry:      cfg.Retry,
+		limiter:    newRateLimiter(cfg.RateLimit),
+		timeout:    cfg.Timeout,
+		done:       make(chan struct{}),
+		deadLetter: cfg.DeadLetter,
+	}
+	if cfg.CircuitBreaker != nil {
+		rcv.breaker = newCircuitBreaker(*cfg.CircuitBreaker, func(state breakerState) {
+			r.MetricsStore.CircuitBreakerState.WithLabelValues(name).Set(float64(state))
+			if state == breakerOpen {
+				log.Warn().Str("sink", name).Msg("Circuit breaker opened, pausing sends to the sink")
+			} else {
+				log.Info().Str("sink", name).Str("state", state.String()).Msg("Circuit breaker state changed")
+			}
+		})
+		r.MetricsStore.CircuitBreakerState.WithLabelValues(name).Set(float64(breakerClosed))
+	}
+	if ins, ok := sink.(sinks.Instrumented); ok {
+		ins.SetMetricsStore(r.MetricsStore, name)
+	}
+	if len(cfg.Processors) > 0 {
+		processors, err := newProcessorChain(cfg.Processors)
+		if err != nil {
+			log.Error().Err(err).Str("sink", name).Msg("Cannot set up processors, sending the events unprocessed")
+		} else {
+			rcv.processors = processors
+		}
+	}
+	if cfg.Dedup != nil {
+		dedup, err := newDeduplicator(name, *cfg.Dedup)
+		if err != nil {
+			log.Error().Err(err).Str("sink", name).Msg("Cannot set up deduplication, sending every event")
+		} else {
+			dedup.setMetricsStore(r.MetricsStore)
+			rcv.dedup = dedup
+		}
+	}
+	if cfg.Group != nil {
+		grouper, err := newGrouper(*cfg.Group, func(ev *kube.EnhancedEvent) { r.sendTo(rcv, ev) })
+		if err != nil {
+			log.Error().Err(err).Str("sink", name).Msg("Cannot set up grouping, sending every event")
+		} else {
+			rcv.grouper = grouper
+		}
+	}
+	if cfg.Batch != nil {
+		if bs, ok := sink.(sinks.BatchSink); ok {
+			rcv.batchSink = bs
+			rcv.batch = *cfg.Batch
+			rcv.batch.SetDefaults()
+		} else {
+			log.Warn().Str("sink", name).Msg("The sink does not support batching, sending the events one by one")
+		}
+	}
+	// The receivers are registered one at a time by the engine. The spool is set up before the receiver is published,
+	// so that every event it gets is spooled, and the spooled events are queued ahead of them.
+	r.mu.RLock()
+	old := r.receivers[name]
+	prev := r.previous(name)
+	r.mu.RUnlock()
+	if err := r.openSpool(rcv, prev, cfg.Spool); err != nil {
+		cancel()
+		return err
+	}
+
+	r.mu.Lock()
+	if r.receivers == nil {
+		r.receivers = make(map[string]*receiver)
+	}
+	r.receivers[name] = rcv
+	if old != nil {
+		r.retire(old)
+	}
 	if r.wg == nil {
 		r.wg = &sync.WaitGroup{}
 	}
+	r.mu.Unlock()
+
+	if old != nil {
+		log.Info().Str("sink", name).Msg("Replacing the receiver, the previous one delivers its queued events first")
+	}
 
 	r.wg.Go(func() {
-	Loop:
-		for {
-			select {
-			case ev := <-ch:
-				log.Debug().Str("sink", name).Str("event", ev.Message).Msg("sending event to sink")
-				err := receiver.Send(context.Background(), &ev)
-				if err != nil {
-					r.MetricsStore.SendErrors.Inc()
-					log.Debug().Err(err).Str("sink", name).Str("event", ev.Message).Msg("Cannot send event")
+		if old != nil {
+			old.stopGrouping()
+			for _, q := range old.queues {
+				q.close()
+			}
+		}
+		if prev != nil {
+			// The new receiver queues the events meanwhile, so the events of an object are still sent in order
+			<-prev.done
+		}
+
+		var workers sync.WaitGroup
+		for _, q := range rcv.queues {
+			workers.Go(func() {
+				if rcv.batchSink != nil {
+					r.workBatches(rcv, q)
+				} else {
+					r.work(rcv, q)
 				}
-			case <-exitCh:
-				log.Info().Str("sink", name).Msg("Closing the sink")
-				break Loop
+			})
+		}
+		workers.Wait()
+
+		if f, ok := sink.(sinks.Flusher); ok {
+			log.Info().Str("sink", name).Msg("Flushing the sink")
+			r.unflushed(rcv, f.Flush(r.closingContext()))
+		}
+		log.Info().Str("sink", name).Msg("Closing the sink")
+		sink.Close()
+		r.mu.Lock()
+		rcv.closingSpool = !rcv.keepSpool
+		r.mu.Unlock()
+		if rcv.spool != nil && rcv.closingSpool {
+			if err := rcv.spool.Close(); err != nil {
+				log.Error().Err(err).Str("sink", name).Msg("Cannot close spool")
 			}
 		}
-		receiver.Close()
 		log.Info().Str("sink", name).Msg("Closed")
+		rcv.cancel()
+		close(rcv.done)
+	})
+	return nil
+}
+
+// previous returns the receiver registered under the name, or else the last one unregistered which is still
+// delivering its queued events, r.mu must be held
+func (r *ChannelBasedReceiverRegistry) previous(name string) *receiver {
+	if rcv := r.receivers[name]; rcv != nil {
+		return rcv
+	}
+	for _, rcv := range slices.Backward(r.draining) {
+		if rcv.name != name {
+			continue
+		}
+		select {
+		case <-rcv.done:
+			return nil
+		default:
+			return rcv
+		}
+	}
+	return nil
+}
+
+// openSpool opens the spool of the receiver, if it has one configured, and replays the events left in it. When the
+// previous receiver uses the same directory, its spool is taken over instead, with the settings it was opened with:
+// the events left in it are still queued by the previous receiver, and a spool cannot be opened twice.
+func (r *ChannelBasedReceiverRegistry) openSpool(rcv, prev *receiver, cfg *spool.Config) error {
+	if cfg == nil {
+		return nil
+	}
+	rcv.spoolDir = filepath.Join(cfg.Dir, url.PathEscape(rcv.name))
+	if prev != nil && prev.spool != nil && prev.spoolDir == rcv.spoolDir {
+		r.mu.Lock()
+		closing := prev.closingSpool
+		prev.keepSpool = !closing
+		r.mu.Unlock()
+		if !closing {
+			rcv.spool = prev.spool
+			return nil
+		}
+		// It is closing the spool already, which is opened again once it is done
+		<-prev.done
+	}
+	sp, err := spool.Open(rcv.spoolDir, *cfg)
+	if err != nil {
+		return fmt.Errorf("cannot open spool: %w", err)
+	}
+	rcv.spool = sp
+	r.MetricsStore.SpoolDepth.WithLabelValues(rcv.name).Set(float64(sp.Depth()))
+	r.replay(rcv)
+	return nil
+}
+
+// Unregister stops accepting events for the named receiver. It delivers the events in its queues and is closed in
+// the background, Close still waits for it.
+func (r *ChannelBasedReceiverRegistry) Unregister(name string) {
+	r.mu.Lock()
+	rcv := r.receivers[name]
+	delete(r.receivers, name)
+	if rcv != nil {
+		r.retire(rcv)
+	}
+	r.mu.Unlock()
+	if rcv == nil {
+		return
+	}
+
+	log.Info().Str("sink", name).Msg("Unregistering the receiver, it delivers its queued events first")
+	rcv.stopGrouping()
+	for _, q := range rcv.queues {
+		q.close()
+	}
+}
+
+// retire keeps track of a receiver which is not registered anymore until it is closed, r.mu must be held
+func (r *ChannelBasedReceiverRegistry) retire(rcv *receiver) {
+	r.draining = slices.DeleteFunc(r.draining, func(d *receiver) bool {
+		select {
+		case <-d.done:
+			return true
+		default:
+			return false
+		}
 	})
+	r.draining = append(r.draining, rcv)
+}
+
+// work sends the events of a receiver queue to the sink until the queue is closed
+func (r *ChannelBasedReceiverRegistry) work(rcv *receiver, q *eventQueue) {
+	for {
+		item, ok := q.pop()
+		if !ok {
+			return
+		}
+		r.MetricsStore.QueueDepth.WithLabelValues(rcv.name).Set(float64(rcv.queueLen()))
+
+		ev := item.event
+		log.Debug().Str("sink", rcv.name).Str("event", ev.Message).Msg("sending event to sink")
+		firstAttempt := time.Now()
+		attempts, err := r.deliver(rcv, &ev)
+		r.finish(rcv, item, attempts, firstAttempt, err)
+	}
+}
+
+// finish accounts for the result of delivering a queued event: failed events are forwarded to the dead-letter
+// receiver, or dropped and counted when there is none or it does not accept them. The spool forgets every event once
+// its delivery is final, only the retries interrupted by the shutdown keep the event for the next start. Keeping the
+// failed events instead would stall the watermark of the spool, and have every later event sent again on restart.
+func (r *ChannelBasedReceiverRegistry) finish(rcv *receiver, item queuedEvent, attempts int, firstAttempt time.Time, err error) {
+	if err != nil {
+		r.MetricsStore.SendErrors.Inc()
+		log.Debug().Err(err).Str("sink", rcv.name).Str("event", item.event.Message).Int("attempts", attempts).Msg("Cannot send event")
+		// Retries interrupted by closing are not final, the event is replayed from the spool instead
+		if !sinks.IsPermanent(err) && rcv.stopping() {
+			r.unflushed(rcv, 1)
+			return
+		}
+		forwarded := rcv.deadLetter != "" && r.sendDeadLetter(rcv, item.event, &kube.DeadLetter{
+			Receiver:         rcv.name,
+			Error:            err.Error(),
+			Attempts:         attempts,
+			FirstAttemptTime: firstAttempt,
+			LastAttemptTime:  time.Now(),
+		})
+		if !forwarded {
+			r.MetricsStore.EventsDropped.WithLabelValues(rcv.name).Inc()
+			log.Warn().Err(err).Str("sink", rcv.name).Str("event", item.event.Message).Int("attempts", attempts).Msg("Dropping event which could not be delivered")
+		}
+	}
+	if item.seq != 0 {
+		r.ack(rcv, item.seq)
+	}
+}
+
+// sendDeadLetter forwards an event which could not be delivered to the dead-letter receiver of rcv. Events which
+// already failed at another receiver keep describing that first failure.
+func (r *ChannelBasedReceiverRegistry) sendDeadLetter(rcv *receiver, ev kube.EnhancedEvent, dl *kube.DeadLetter) bool {
+	if ev.DeadLetter == nil {
+		ev.DeadLetter = dl
+	}
+	log.Debug().Str("sink", rcv.name).Str("deadLetter", rcv.deadLetter).Str("event", ev.Message).Msg("Forwarding event to dead-letter receiver")
+	return r.send(rcv.deadLetter, &ev)
+}
+
+// enqueue pushes the event to the receiver queue and accounts for the event dropped by the overflow policy, if any.
+// It reports whether the queue accepted the event, which is the case unless it is closed.
+func (r *ChannelBasedReceiverRegistry) enqueue(rcv *receiver, item queuedEvent) bool {
+	dropped, ok, err := rcv.queueFor(&item.event).push(item)
+	if err != nil {
+		// The event stays in the spool, if any, and is replayed on the next start
+		log.Warn().Err(err).Str("sink", rcv.name).Str("event", item.event.Message).Msg("Cannot queue event")
+		return false
+	}
+	if ok {
+		r.MetricsStore.EventsDropped.WithLabelValues(rcv.name).Inc()
+		log.Debug().Str("sink", rcv.name).Str("event", dropped.event.Message).Msg("Receiver queue is full, dropping event")
+		// A dropped event is not going to be delivered, there is no point in replaying it
+		if dropped.seq != 0 {
+			r.ack(rcv, dropped.seq)
+		}
+	}
+	r.MetricsStore.QueueDepth.WithLabelValues(rcv.name).Set(float64(rcv.queueLen()))
+	return true
+}
+
+// replay queues the events which were left in the spool by a previous run, in their original order. It runs before
+// the receiver gets any new event, so the replayed events of an object are sent before its new ones. The queues take
+// all of them regardless of their bound, as the workers only start afterwards.
+func (r *ChannelBasedReceiverRegistry) replay(rcv *receiver) {
+	pending := rcv.spool.Pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	log.Info().Str("sink", rcv.name).Int("events", len(pending)).Msg("Replaying spooled events")
+	for _, rec := range pending {
+		item := queuedEvent{seq: rec.Seq}
+		if err := json.Unmarshal(rec.Data, &item.event); err != nil {
+			log.Error().Err(err).Str("sink", rcv.name).Uint64("seq", rec.Seq).Msg("Cannot decode spooled event, skipping")
+			r.ack(rcv, rec.Seq)
+			continue
+		}
+		rcv.queueFor(&item.event).restore(item)
+	}
+	r.MetricsStore.QueueDepth.WithLabelValues(rcv.name).Set(float64(rcv.queueLen()))
+}
+
+func (r *ChannelBasedReceiverRegistry) ack(rcv *receiver, seq uint64) {
+	if err := rcv.spool.Ack(seq); err != nil {
+		log.Error().Err(err).Str("sink", rcv.name).Msg("Cannot acknowledge spooled event")
+	}
+	r.MetricsStore.SpoolDepth.WithLabelValues(rcv.name).Set(float64(rcv.spool.Depth()))
+}
+
+// Ready returns an error naming the receivers whose circuit breaker is not closed
+func (r *ChannelBasedReceiverRegistry) Ready() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var unhealthy []string
+	for name, rcv := range r.receivers {
+		if rcv.breaker == nil {
+			continue
+		}
+		if state := rcv.breaker.current(); state != breakerClosed {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", name, state))
+		}
+	}
+	if len(unhealthy) == 0 {
+		return nil
+	}
+	slices.Sort(unhealthy)
+	return fmt.Errorf("circuit breaker not closed for receivers: %s", strings.Join(unhealthy, ", "))
+}
+
+// Close stops accepting events and waits until the receivers delivered their queued events. A receiver is closed
+// after the receivers which forward their failed events to it. When ctx is done first, the events which are not
+// delivered yet are discarded and counted, spooled ones are replayed on the next start.
+func (r *ChannelBasedReceiverRegistry) Close(ctx context.Context) {
+	r.mu.Lock()
+	r.closing = ctx
+	receivers := maps.Clone(r.receivers)
+	draining := slices.Clone(r.draining)
+	r.mu.Unlock()
+	if r.wg == nil {
+		return
+	}
+
+	// The pending group notifications are queued before any queue is closed, as grouped events may also be
+	// forwarded to a dead-letter receiver
+	for _, rcv := range receivers {
+		rcv.stopGrouping()
+	}
+	for _, rcv := range receivers {
+		var sources []*receiver
+		for _, src := range receivers {
+			if src.deadLetter == rcv.name {
+				sources = append(sources, src)
+			}
+		}
+		go func() {
+			for _, src := range sources {
+				select {
+				case <-src.done:
+				case <-ctx.Done():
+				}
+			}
+			for _, q := range rcv.queues {
+				q.close()
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return
+	case <-ctx.Done():
+	}
+
+	log.Warn().Msg("Shutdown timeout reached, discarding the events which are not delivered yet")
+	for _, rcv := range slices.Concat(slices.Collect(maps.Values(receivers)), draining) {
+		rcv.cancel()
+		discarded := 0
+		for _, q := range rcv.queues {
+			discarded += len(q.abort())
+		}
+		r.unflushed(rcv, discarded)
+	}
+	<-finished
+}
+
+// closingContext returns the context bounding the shutdown, it is only set once Close is called
+func (r *ChannelBasedReceiverRegistry) closingContext() context.Context {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closing == nil {
+		return context.Background()
+	}
+	return r.closing
 }
 
-// Close signals closing to all sinks and waits for them to complete.
-// The wait could block indefinitely depending on the sink implementations.
-func (r *ChannelBasedReceiverRegistry) Close() {
-	// Send exit command and wait for exit of all sinks
-	for _, ec := range r.exitCh {
-		ec <- 1
+// unflushed accounts for events which were not delivered before the registry closed
+func (r *ChannelBasedReceiverRegistry) unflushed(rcv *receiver, n int) {
+	if n == 0 {
+		return
 	}
-	r.wg.Wait()
+	r.MetricsStore.EventsUnflushed.WithLabelValues(rcv.name).Add(float64(n))
+	log.Warn().Str("sink", rcv.name).Int("events", n).Msg("Events were not delivered before shutdown")
 }
@@ -0,0 +1,445 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/spool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestMetricsStore(t *testing.T) *metrics.Store {
+	t.Helper()
+	// generate a test-unique prefix using the test name + timestamp
+	ms := metrics.NewMetricsStore(fmt.Sprintf("%s_%d_", t.Name(), time.Now().UnixNano()))
+	t.Cleanup(func() {
+		metrics.DestroyMetricsStore(ms)
+	})
+	return ms
+}
+
+// recordingSink records the events it receives and fails while err is set
+type recordingSink struct {
+	err    error
+	events []kube.EnhancedEvent
+	mu     sync.Mutex
+}
+
+func (s *recordingSink) Send(_ context.Context, ev *kube.EnhancedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+func (s *recordingSink) Close() {}
+
+func (s *recordingSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := make([]string, 0, len(s.events))
+	for i := range s.events {
+		msgs = append(msgs, s.events[i].Message)
+	}
+	return msgs
+}
+
+func (s *recordingSink) receivedEvents() []kube.EnhancedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]kube.EnhancedEvent(nil), s.events...)
+}
+
+func eventWithMessage(msg string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Message = msg
+	return ev
+}
+
+func TestChannelBasedReceiverRegistry_ReplaysSpooledEvents(t *testing.T) {
+	store := newTestMetricsStore(t)
+	cfg := &sinks.ReceiverConfig{Name: "spooled", Spool: &spool.Config{Dir: t.TempDir(), Fsync: spool.FsyncAlways}}
+
+	// The retries are interrupted by the shutdown, so the events stay in the spool
+	failing := &recordingSink{err: errors.New("unavailable")}
+	retrying := *cfg
+	retrying.Retry = &sinks.RetryConfig{MaxAttempts: 10, BaseBackoff: time.Hour, MaxBackoff: time.Hour}
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	require.NoError(t, reg.Register(cfg.Name, failing, &retrying))
+	reg.SendEvent(cfg.Name, eventWithMessage("first"))
+	reg.SendEvent(cfg.Name, eventWithMessage("second"))
+	assert.Equal(t, 2, reg.receivers[cfg.Name].spool.Depth())
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	reg.Close(ctx)
+
+	// The replayed events are queued beyond the bound of the queue, ahead of the new ones
+	working := &recordingSink{}
+	small := *cfg
+	small.Queue = sinks.QueueConfig{Size: 1}
+	reg = &ChannelBasedReceiverRegistry{MetricsStore: store}
+	require.NoError(t, reg.Register(cfg.Name, working, &small))
+	reg.SendEvent(cfg.Name, eventWithMessage("third"))
+	require.Eventually(t, func() bool {
+		return len(working.received()) == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"first", "second", "third"}, working.received())
+	require.Eventually(t, func() bool {
+		return reg.receivers[cfg.Name].spool.Depth() == 0
+	}, time.Second, 5*time.Millisecond)
+	reg.Close(context.Background())
+}
+
+func TestChannelBasedReceiverRegistry_AcksUndeliverableSpooledEvents(t *testing.T) {
+	store := newTestMetricsStore(t)
+	cfg := &sinks.ReceiverConfig{Name: "spooled", Spool: &spool.Config{Dir: t.TempDir(), Fsync: spool.FsyncAlways}}
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	require.NoError(t, reg.Register(cfg.Name, &recordingSink{err: errors.New("unavailable")}, cfg))
+
+	reg.SendEvent(cfg.Name, eventWithMessage("lost"))
+	require.Eventually(t, func() bool {
+		return reg.receivers[cfg.Name].spool.Depth() == 0
+	}, time.Second, 5*time.Millisecond)
+	reg.Close(context.Background())
+	assert.InDelta(t, 1, testutil.ToFloat64(store.EventsDropped.WithLabelValues(cfg.Name)), 0)
+
+	// The spool moved on, nothing is replayed
+	working := &recordingSink{}
+	reg = &ChannelBasedReceiverRegistry{MetricsStore: store}
+	require.NoError(t, reg.Register(cfg.Name, working, cfg))
+	reg.SendEvent(cfg.Name, eventWithMessage("next"))
+	reg.Close(context.Background())
+	assert.Equal(t, []string{"next"}, working.received())
+}
+
+func TestChannelBasedReceiverRegistry_ForwardsFailedEventsToDeadLetter(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	rejecting := &recordingSink{err: sinks.Permanent(errors.New("bad request"))}
+	deadLetter := &recordingSink{}
+	reg.Register("webhook", rejecting, &sinks.ReceiverConfig{Name: "webhook", DeadLetter: "dlq"})
+	reg.Register("dlq", deadLetter, &sinks.ReceiverConfig{Name: "dlq"})
+
+	reg.SendEvent("webhook", eventWithMessage("rejected"))
+
+	require.Eventually(t, func() bool {
+		return len(deadLetter.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	reg.Close(context.Background())
+
+	ev := deadLetter.receivedEvents()[0]
+	assert.Equal(t, "rejected", ev.Message)
+	require.NotNil(t, ev.DeadLetter)
+	assert.Equal(t, "webhook", ev.DeadLetter.Receiver)
+	assert.Equal(t, "bad request", ev.DeadLetter.Error)
+	assert.Equal(t, 1, ev.DeadLetter.Attempts)
+	assert.False(t, ev.DeadLetter.FirstAttemptTime.IsZero())
+	assert.False(t, ev.DeadLetter.LastAttemptTime.Before(ev.DeadLetter.FirstAttemptTime))
+}
+
+// blockingSink holds the events of the blocked object until release is closed
+type blockingSink struct {
+	recordingSink
+	blocked types.UID
+	release chan struct{}
+}
+
+func (s *blockingSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	if ev.InvolvedObject.UID == s.blocked {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return s.recordingSink.Send(ctx, ev)
+}
+
+func eventForObject(uid types.UID, msg string) *kube.EnhancedEvent {
+	ev := eventWithMessage(msg)
+	ev.InvolvedObject.UID = uid
+	return ev
+}
+
+func TestChannelBasedReceiverRegistry_ConcurrentWorkersKeepObjectOrder(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	reg.Register("kafka", sink, &sinks.ReceiverConfig{Name: "kafka", Concurrency: 4})
+	rcv := reg.receivers["kafka"]
+
+	// Find an object which is handled by another worker than the blocked one
+	var fast types.UID
+	for i := range 100 {
+		uid := types.UID(fmt.Sprintf("fast-%d", i))
+		if rcv.queueFor(eventForObject(uid, "")) != rcv.queueFor(eventForObject(sink.blocked, "")) {
+			fast = uid
+			break
+		}
+	}
+	require.NotEmpty(t, fast)
+
+	reg.SendEvent("kafka", eventForObject(sink.blocked, "slow-1"))
+	reg.SendEvent("kafka", eventForObject(sink.blocked, "slow-2"))
+	reg.SendEvent("kafka", eventForObject(fast, "fast-1"))
+	reg.SendEvent("kafka", eventForObject(fast, "fast-2"))
+
+	// The blocked object does not stall the events of other objects
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"fast-1", "fast-2"}, sink.received())
+
+	close(sink.release)
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 4
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"fast-1", "fast-2", "slow-1", "slow-2"}, sink.received())
+	reg.Close(context.Background())
+}
+
+// flushingSink buffers the events until it is flushed
+type flushingSink struct {
+	recordingSink
+	buffered []string
+	left     int
+}
+
+func (s *flushingSink) Send(_ context.Context, ev *kube.EnhancedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffered = append(s.buffered, ev.Message)
+	return nil
+}
+
+func (s *flushingSink) Flush(_ context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range s.buffered[:len(s.buffered)-s.left] {
+		s.events = append(s.events, *eventWithMessage(msg))
+	}
+	return s.left
+}
+
+func TestChannelBasedReceiverRegistry_CloseDrainsQueues(t *testing.T) {
+	store := newTestMetricsStore(t)
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	sink := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	flushing := &flushingSink{left: 1}
+	reg.Register("webhook", sink, &sinks.ReceiverConfig{Name: "webhook"})
+	reg.Register("bigquery", flushing, &sinks.ReceiverConfig{Name: "bigquery"})
+
+	for _, msg := range []string{"1", "2", "3"} {
+		reg.SendEvent("webhook", eventForObject(sink.blocked, msg))
+		reg.SendEvent("bigquery", eventWithMessage(msg))
+	}
+	time.AfterFunc(20*time.Millisecond, func() { close(sink.release) })
+	reg.Close(context.Background())
+
+	assert.Equal(t, []string{"1", "2", "3"}, sink.received())
+	assert.Equal(t, []string{"1", "2"}, flushing.received())
+	assert.InDelta(t, 1, testutil.ToFloat64(store.EventsUnflushed.WithLabelValues("bigquery")), 0)
+
+	// Intake is stopped
+	reg.SendEvent("webhook", eventWithMessage("late"))
+	assert.Len(t, sink.received(), 3)
+}
+
+func TestChannelBasedReceiverRegistry_CloseDiscardsAfterTimeout(t *testing.T) {
+	store := newTestMetricsStore(t)
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	sink := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	reg.Register("webhook", sink, &sinks.ReceiverConfig{Name: "webhook"})
+	for _, msg := range []string{"1", "2", "3"} {
+		reg.SendEvent("webhook", eventForObject(sink.blocked, msg))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	reg.Close(ctx)
+
+	// The send in flight is canceled and the two queued events are discarded
+	assert.Empty(t, sink.received())
+	assert.InDelta(t, 3, testutil.ToFloat64(store.EventsUnflushed.WithLabelValues("webhook")), 0)
+}
+
+func TestChannelBasedReceiverRegistry_TimeoutBoundsSend(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	reg.Register("webhook", sink, &sinks.ReceiverConfig{Name: "webhook", Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	attempts, err := reg.deliver(reg.receivers["webhook"], eventForObject(sink.blocked, "hung"))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Second)
+	reg.Close(context.Background())
+}
+
+// batchingSink records the sizes of the batches it receives, and fails the events whose message is in errs once
+type batchingSink struct {
+	recordingSink
+	errs    map[string]error
+	batches []int
+}
+
+func (s *batchingSink) SendBatch(_ context.Context, evs []*kube.EnhancedEvent) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(evs))
+	errs := make([]error, len(evs))
+	for i, ev := range evs {
+		if err, ok := s.errs[ev.Message]; ok {
+			delete(s.errs, ev.Message)
+			errs[i] = err
+			continue
+		}
+		s.events = append(s.events, *ev)
+	}
+	return errs
+}
+
+func (s *batchingSink) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...)
+}
+
+func TestChannelBasedReceiverRegistry_SendsBatches(t *testing.T) {
+	store := newTestMetricsStore(t)
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	sink := &batchingSink{errs: map[string]error{
+		"2": errors.New("unavailable"),
+		"3": sinks.Permanent(errors.New("too large")),
+	}}
+	deadLetter := &recordingSink{}
+	reg.Register("kinesis", sink, &sinks.ReceiverConfig{
+		Name:       "kinesis",
+		Batch:      &sinks.BatchConfig{Size: 4, MaxLatency: time.Hour},
+		Retry:      &sinks.RetryConfig{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		DeadLetter: "dlq",
+	})
+	reg.Register("dlq", deadLetter, &sinks.ReceiverConfig{Name: "dlq"})
+
+	for _, msg := range []string{"1", "2", "3", "4", "5"} {
+		reg.SendEvent("kinesis", eventWithMessage(msg))
+	}
+	require.Eventually(t, func() bool {
+		return len(sink.received()) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	// Only the event which failed with a retryable error is sent again, the rejected one is dead-lettered
+	assert.Equal(t, []string{"1", "4", "2"}, sink.received())
+	assert.Equal(t, []int{4, 1}, sink.batchSizes())
+	assert.InDelta(t, 1, testutil.ToFloat64(store.SendRetries.WithLabelValues("kinesis")), 0)
+	require.Eventually(t, func() bool {
+		return len(deadLetter.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"3"}, deadLetter.received())
+
+	// The last event is sent as a partial batch on closing
+	reg.Close(context.Background())
+	assert.Equal(t, []string{"1", "4", "2", "5"}, sink.received())
+}
+
+func TestChannelBasedReceiverRegistry_ReplacesReceiverAfterDraining(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	old := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	reg.Register("webhook", old, &sinks.ReceiverConfig{Name: "webhook"})
+	reg.SendEvent("webhook", eventForObject(old.blocked, "1"))
+	reg.SendEvent("webhook", eventForObject(old.blocked, "2"))
+
+	replacement := &recordingSink{}
+	reg.Register("webhook", replacement, &sinks.ReceiverConfig{Name: "webhook"})
+	reg.SendEvent("webhook", eventWithMessage("3"))
+
+	// The replacement waits until the previous receiver delivered its queued events
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, replacement.received())
+	close(old.release)
+	require.Eventually(t, func() bool {
+		return len(replacement.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"1", "2"}, old.received())
+	assert.Equal(t, []string{"3"}, replacement.received())
+
+	reg.Unregister("webhook")
+	reg.Close(context.Background())
+	reg.SendEvent("webhook", eventWithMessage("late"))
+	assert.Len(t, replacement.received(), 1)
+}
+
+func TestChannelBasedReceiverRegistry_ReplacementTakesOverSpool(t *testing.T) {
+	store := newTestMetricsStore(t)
+	cfg := &sinks.ReceiverConfig{Name: "spooled", Spool: &spool.Config{Dir: t.TempDir(), Fsync: spool.FsyncAlways}}
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	old := &blockingSink{blocked: "slow", release: make(chan struct{})}
+	require.NoError(t, reg.Register(cfg.Name, old, cfg))
+	reg.SendEvent(cfg.Name, eventForObject(old.blocked, "1"))
+
+	// The events the replacement gets while the previous receiver drains are spooled as well
+	replacement := &recordingSink{}
+	require.NoError(t, reg.Register(cfg.Name, replacement, cfg))
+	reg.SendEvent(cfg.Name, eventForObject(old.blocked, "2"))
+	sp := reg.receivers[cfg.Name].spool
+	assert.Equal(t, 2, sp.Depth())
+
+	close(old.release)
+	require.Eventually(t, func() bool {
+		return sp.Depth() == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"1"}, old.received())
+	assert.Equal(t, []string{"2"}, replacement.received())
+
+	// The spool is still open after the previous receiver closed
+	reg.SendEvent(cfg.Name, eventWithMessage("3"))
+	reg.Close(context.Background())
+	assert.Equal(t, []string{"2", "3"}, replacement.received())
+	assert.Equal(t, 0, sp.Depth())
+}
+
+func TestChannelBasedReceiverRegistry_DeduplicatesEvents(t *testing.T) {
+	store := newTestMetricsStore(t)
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: store}
+	sink := &recordingSink{}
+	reg.Register("dedup", sink, &sinks.ReceiverConfig{Name: "dedup", Dedup: &sinks.DedupConfig{Fields: []string{"message"}}})
+
+	for _, msg := range []string{"1", "1", "2", "1"} {
+		reg.SendEvent("dedup", eventWithMessage(msg))
+	}
+	reg.Close(context.Background())
+
+	assert.Equal(t, []string{"1", "2"}, sink.received())
+	assert.InDelta(t, 2, testutil.ToFloat64(store.EventsSuppressed.WithLabelValues("dedup")), 0)
+}
+
+func TestChannelBasedReceiverRegistry_GroupsEvents(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &recordingSink{}
+	reg.Register("grouped", sink, &sinks.ReceiverConfig{Name: "grouped", Group: &sinks.GroupConfig{GroupWait: time.Hour}})
+
+	for _, msg := range []string{"1", "2", "3"} {
+		reg.SendEvent("grouped", eventWithMessage(msg))
+	}
+	// Closing sends the pending notifications
+	reg.Close(context.Background())
+
+	events := sink.receivedEvents()
+	require.Len(t, events, 1)
+	require.NotNil(t, events[0].Group)
+	assert.Len(t, events[0].Group.Events, 3)
+	assert.Equal(t, "3", events[0].Message)
+}
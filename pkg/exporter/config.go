@@ -4,12 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/Masterminds/sprig/v3"
 	"github.com/rs/zerolog/log"
 	"k8s.io/client-go/rest"
 )
@@ -18,7 +23,9 @@ const (
 	DefaultCacheSize        = 1024
 	DefaultMappingCacheSize = DefaultCacheSize / 4
 	defaultCacheTTL         = 12 * time.Hour
-	maxCacheTTL             = 30 * 24 * time.Hour
+	// defaultShutdownTimeout leaves some room within the default termination grace period of a pod
+	defaultShutdownTimeout = 25 * time.Second
+	maxCacheTTL            = 30 * 24 * time.Hour
 )
 
 // Config allows configuration
@@ -66,6 +73,34 @@ type Config struct {
 	// OmitLookup indicates whether to omit involved
 	// object metadata (Labels, Annotations, OwnerReferences) lookups
 	OmitLookup bool `yaml:"omitLookup,omitempty"`
+
+	// ResolveOwners enables following the owner chain of the involved object up to its top-level controller, e.g.
+	// the Deployment of a Pod, which costs a lookup per owner the first time it is seen
+	ResolveOwners bool `yaml:"resolveOwners,omitempty"`
+
+	// NamespaceMetadata enables an informer of the namespaces, which adds their labels and annotations to the events
+	NamespaceMetadata bool `yaml:"namespaceMetadata,omitempty"`
+
+	// Processors transform the events before they are silenced and routed, e.g. to redact secrets from the messages
+	// or to set custom fields
+	Processors []sinks.ProcessorConfig `yaml:"processors"`
+
+	// Silences mute the matching events before they are routed, e.g. during maintenance
+	Silences []Silence `yaml:"silences"`
+	// SilencesAPI configures the HTTP API creating silences at runtime
+	SilencesAPI SilencesAPIConfig `yaml:"silencesAPI"`
+
+	// AnnotationOverrides lets the annotations of the involved objects add receivers to their events or drop them
+	AnnotationOverrides AnnotationOverridesConfig `yaml:"annotationOverrides"`
+
+	// RouteTraces is the number of routing traces of the last events which are kept for the /debug/routes
+	// endpoint, zero disables the tracing
+	RouteTraces int `yaml:"routeTraces,omitempty"`
+	// DryRun logs the routing decisions instead of sending the events, no sink is initialized
+	DryRun bool `yaml:"dryRun,omitempty"`
+
+	// ShutdownTimeout is how long the receivers may deliver their pending events on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout,omitempty"`
 }
 
 func (c *Config) SetDefaults() {
@@ -106,6 +141,39 @@ func (c *Config) SetDefaults() {
 		c.CacheTTL = defaultCacheTTL.String()
 		log.Debug().Str("cacheTTL", c.CacheTTL).Msg("setting config.cacheTTL to default (12h)")
 	}
+
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+		log.Debug().Dur("shutdownTimeout", c.ShutdownTimeout).Msg("setting config.shutdownTimeout to default")
+	}
+
+	for i := range c.Processors {
+		c.Processors[i].SetDefaults()
+	}
+	for i := range c.Receivers {
+		c.Receivers[i].SetDefaults()
+	}
+}
+
+// reloadableSettings are the settings a reload applies, the others keep the value the exporter was started with
+var reloadableSettings = []string{"route", "receivers", "processors", "silences", "annotationOverrides"}
+
+// restartRequired returns the names of the settings which differ from the running config but only take effect on a
+// restart
+func (c *Config) restartRequired(running *Config) []string {
+	var changed []string
+	cv, rv := reflect.ValueOf(c).Elem(), reflect.ValueOf(running).Elem()
+	for i := range cv.NumField() {
+		field := cv.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "-" || slices.Contains(reloadableSettings, name) {
+			continue
+		}
+		if !reflect.DeepEqual(cv.Field(i).Interface(), rv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
 }
 
 func (c *Config) Validate() error {
@@ -115,6 +183,21 @@ func (c *Config) Validate() error {
 	if err := c.validateMetricsNamePrefix(); err != nil {
 		return err
 	}
+	if err := c.validateReceivers(); err != nil {
+		return err
+	}
+
+	for i := range c.Processors {
+		if err := c.Processors[i].Validate(); err != nil {
+			return fmt.Errorf("processors[%d]: %w", i, err)
+		}
+	}
+	if err := c.validateSilences(); err != nil {
+		return err
+	}
+	if err := c.AnnotationOverrides.validate(c.Receivers); err != nil {
+		return err
+	}
 
 	// Precompile all regex patterns
 	err := c.PreCompilePatterns()
@@ -122,16 +205,76 @@ func (c *Config) Validate() error {
 		return err
 	}
 
-	// No duplicate receivers
-	// Receivers individually
 	// Routers recursive
 	return nil
 }
 
+// SilencesAPIConfig enables the silences API on the metrics server, requests must carry the token as a bearer token
+type SilencesAPIConfig struct {
+	Token string `yaml:"token"`
+}
+
+// validateSilences checks and precompiles the silences, their ids must be unique
+func (c *Config) validateSilences() error {
+	ids := make(map[string]struct{}, len(c.Silences))
+	for i := range c.Silences {
+		s := &c.Silences[i]
+		if err := s.compile(); err != nil {
+			return fmt.Errorf("silences[%d]: %w", i, err)
+		}
+		if _, ok := ids[s.ID]; ok {
+			return fmt.Errorf("silences[%d]: duplicate silence id %q", i, s.ID)
+		}
+		ids[s.ID] = struct{}{}
+	}
+	return nil
+}
+
+// validateReceivers checks every receiver individually, that no receiver name is used twice and that dead-letter
+// receivers exist and do not form a cycle
+func (c *Config) validateReceivers() error {
+	deadLetters := make(map[string]string, len(c.Receivers))
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("validateReceivers failed: %w", err)
+		}
+		if _, ok := deadLetters[r.Name]; ok {
+			return fmt.Errorf("validateReceivers failed: duplicate receiver name %q", r.Name)
+		}
+		deadLetters[r.Name] = r.DeadLetter
+	}
+
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if r.DeadLetter == "" {
+			continue
+		}
+		if _, ok := deadLetters[r.DeadLetter]; !ok {
+			return fmt.Errorf("validateReceivers failed: receiver %q: unknown deadLetter receiver %q", r.Name, r.DeadLetter)
+		}
+		// Follow the chain of dead-letter receivers, it must end before getting back to a receiver on it
+		chain := []string{r.Name}
+		for next := r.DeadLetter; next != ""; next = deadLetters[next] {
+			if slices.Contains(chain, next) {
+				return fmt.Errorf("validateReceivers failed: deadLetter cycle %s -> %s", strings.Join(chain, " -> "), next)
+			}
+			chain = append(chain, next)
+		}
+	}
+	return nil
+}
+
 func (c *Config) validateDefaults() error {
 	if err := c.validateMaxEventAgeSeconds(); err != nil {
 		return err
 	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdownTimeout must not be negative, got %s", c.ShutdownTimeout)
+	}
+	if c.RouteTraces < 0 {
+		return fmt.Errorf("routeTraces must not be negative, got %d", c.RouteTraces)
+	}
 	if err := c.validateCacheTTL(); err != nil {
 		return err
 	}
@@ -238,6 +381,9 @@ func compilePatternMap(patterns map[string]string) (map[string]*regexp.Regexp, e
 
 // preCompilePatternsHelper precompiles regex patterns for a given rule
 func (c *Config) preCompilePatternsHelper(rule *Rule) error {
+	if err := rule.validateRanges(); err != nil {
+		return err
+	}
 	var err error
 	rule.apiVersionPattern, err = compilePattern(rule.APIVersion)
 	if err != nil {
@@ -268,14 +414,49 @@ func (c *Config) preCompilePatternsHelper(rule *Rule) error {
 	if err != nil {
 		return err
 	}
-	rule.messagePattern, err = compilePattern(rule.Message)
+	rule.ownerKindPattern, err = compilePattern(rule.OwnerKind)
 	if err != nil {
 		return err
 	}
-	rule.receiverPattern, err = compilePattern(rule.Receiver)
+	rule.ownerNamePattern, err = compilePattern(rule.OwnerName)
 	if err != nil {
 		return err
 	}
+	rule.namePattern, err = compilePattern(rule.Name)
+	if err != nil {
+		return err
+	}
+	rule.fieldPathPattern, err = compilePattern(rule.FieldPath)
+	if err != nil {
+		return err
+	}
+	rule.controllerPattern, err = compilePattern(rule.ReportingController)
+	if err != nil {
+		return err
+	}
+	rule.instancePattern, err = compilePattern(rule.ReportingInstance)
+	if err != nil {
+		return err
+	}
+	rule.actionPattern, err = compilePattern(rule.Action)
+	if err != nil {
+		return err
+	}
+	rule.relatedKindPattern, err = compilePattern(rule.RelatedKind)
+	if err != nil {
+		return err
+	}
+	rule.relatedNamePattern, err = compilePattern(rule.RelatedName)
+	if err != nil {
+		return err
+	}
+	rule.messagePattern, err = compilePattern(rule.Message)
+	if err != nil {
+		return err
+	}
+	if err = c.compileReceiver(rule); err != nil {
+		return err
+	}
 	rule.labelsPatterns, err = compilePatternMap(rule.Labels)
 	if err != nil {
 		return err
@@ -284,26 +465,123 @@ func (c *Config) preCompilePatternsHelper(rule *Rule) error {
 	if err != nil {
 		return err
 	}
+	rule.namespaceLabelsPatterns, err = compilePatternMap(rule.NamespaceLabels)
+	if err != nil {
+		return err
+	}
+	rule.namespaceAnnotationsPatterns, err = compilePatternMap(rule.NamespaceAnnotations)
+	if err != nil {
+		return err
+	}
+	rule.fieldsPatterns, err = compilePatternMap(rule.Fields)
+	if err != nil {
+		return err
+	}
+	if (len(rule.NamespaceLabels) > 0 || len(rule.NamespaceAnnotations) > 0) && !c.NamespaceMetadata {
+		log.Warn().Msg("A rule matches namespaceLabels or namespaceAnnotations, which are empty unless namespaceMetadata is enabled")
+	}
+	rule.expressions = nil
+	for _, e := range rule.MatchExpressions {
+		m, err := compileExpression(e)
+		if err != nil {
+			return err
+		}
+		rule.expressions = append(rule.expressions, m)
+	}
+	rule.program = nil
+	if rule.Expression != "" {
+		rule.program, err = compileCELExpression(rule.Expression)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileReceiver prepares the receiver of the rule according to its mode. A regex receiver is resolved to the
+// configured receivers it matches, a template receiver is parsed and renders one of them. The additional receivers
+// must be configured ones.
+func (c *Config) compileReceiver(rule *Rule) error {
+	rule.receiverTemplate, rule.receiverNames, rule.knownReceivers = nil, nil, nil
+	for _, name := range rule.Receivers {
+		if !slices.ContainsFunc(c.Receivers, func(r sinks.ReceiverConfig) bool { return r.Name == name }) {
+			return fmt.Errorf("unknown receiver %q in receivers", name)
+		}
+	}
+	switch rule.ReceiverMode {
+	case "", ReceiverModeName:
+		// The receiver is used as is, it is not a pattern
+		if rule.DefaultReceiver != "" {
+			return fmt.Errorf("defaultReceiver requires receiverMode %q", ReceiverModeTemplate)
+		}
+	case ReceiverModeRegex:
+		if rule.Receiver == "" {
+			return fmt.Errorf("receiverMode %q requires a receiver", ReceiverModeRegex)
+		}
+		pattern, err := regexp.Compile(rule.Receiver)
+		if err != nil {
+			return err
+		}
+		for _, r := range c.Receivers {
+			if pattern.MatchString(r.Name) {
+				rule.receiverNames = append(rule.receiverNames, r.Name)
+			}
+		}
+		if len(rule.receiverNames) == 0 {
+			return fmt.Errorf("receiver pattern %q matches no receiver", rule.Receiver)
+		}
+	case ReceiverModeTemplate:
+		if rule.Receiver == "" {
+			return fmt.Errorf("receiverMode %q requires a receiver", ReceiverModeTemplate)
+		}
+		tmpl, err := template.New("receiver").Funcs(sprig.TxtFuncMap()).Parse(rule.Receiver)
+		if err != nil {
+			return err
+		}
+		rule.knownReceivers = make(map[string]struct{}, len(c.Receivers))
+		for _, r := range c.Receivers {
+			rule.knownReceivers[r.Name] = struct{}{}
+		}
+		if _, ok := rule.knownReceivers[rule.DefaultReceiver]; rule.DefaultReceiver != "" && !ok {
+			return fmt.Errorf("unknown defaultReceiver %q", rule.DefaultReceiver)
+		}
+		rule.receiverTemplate = tmpl
+	default:
+		return fmt.Errorf("unknown receiverMode %q, expected one of %q, %q or %q", rule.ReceiverMode,
+			ReceiverModeName, ReceiverModeRegex, ReceiverModeTemplate)
+	}
 	return nil
 }
 
-// preCompileRoute precompiles regex patterns for all rules in a route, including nested routes
-func (c *Config) preCompileRoute(route *Route) error {
+// preCompileRoute precompiles regex patterns for all rules in a route, including nested routes, and sets up the
+// deduplication of the routes which have it configured. The path of the route names it in errors and metrics.
+func (c *Config) preCompileRoute(route *Route, path string) error {
 	for i := range route.Drop {
 		if err := c.preCompilePatternsHelper(&route.Drop[i]); err != nil {
-			return err
+			return fmt.Errorf("%s.drop[%d]: %w", path, i, err)
 		}
 	}
 
 	for i := range route.Match {
 		if err := c.preCompilePatternsHelper(&route.Match[i]); err != nil {
-			return err
+			return fmt.Errorf("%s.match[%d]: %w", path, i, err)
+		}
+	}
+
+	if route.Dedup != nil {
+		if err := route.Dedup.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		dedup, err := newDeduplicator(path, *route.Dedup)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
 		}
+		route.dedup = dedup
 	}
 
 	// Recursively compile patterns for nested Routes
 	for i := range route.Routes {
-		if err := c.preCompileRoute(&route.Routes[i]); err != nil {
+		if err := c.preCompileRoute(&route.Routes[i], fmt.Sprintf("%s.routes[%d]", path, i)); err != nil {
 			return err
 		}
 	}
@@ -312,5 +590,5 @@ func (c *Config) preCompileRoute(route *Route) error {
 }
 
 func (c *Config) PreCompilePatterns() error {
-	return c.preCompileRoute(&c.Route)
+	return c.preCompileRoute(&c.Route, "route")
 }
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"os"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
 	"github.com/goccy/go-yaml"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +17,34 @@ import (
 	"k8s.io/client-go/rest"
 )
 
+// logBuffer collects the logs of a test, the receivers may write to it concurrently
+type logBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends the logs to a buffer until the test ends
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	output := &logBuffer{}
+	logger := log.Logger
+	log.Logger = log.Logger.Output(output)
+	t.Cleanup(func() { log.Logger = logger })
+	return output
+}
+
 func readConfig(t *testing.T, yml string) Config {
 	var cfg Config
 	err := yaml.Unmarshal([]byte(yml), &cfg)
@@ -57,8 +88,7 @@ func TestValidate_IsCheckingMaxEventAgeSeconds_WhenNotSet(t *testing.T) {
 }
 
 func TestValidate_IsCheckingMaxEventAgeSeconds_WhenThrottledPeriodSet(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	config := Config{
 		ThrottlePeriod: 123,
@@ -72,8 +102,7 @@ func TestValidate_IsCheckingMaxEventAgeSeconds_WhenThrottledPeriodSet(t *testing
 }
 
 func TestValidate_IsCheckingMaxEventAgeSeconds_WhenMaxEventAgeSecondsSet(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	config := Config{
 		MaxEventAgeSeconds: 123,
@@ -85,8 +114,7 @@ func TestValidate_IsCheckingMaxEventAgeSeconds_WhenMaxEventAgeSecondsSet(t *test
 }
 
 func TestValidate_IsCheckingMaxEventAgeSeconds_WhenMaxEventAgeSecondsAndThrottledPeriodSet(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	config := Config{
 		ThrottlePeriod:     123,
@@ -98,8 +126,7 @@ func TestValidate_IsCheckingMaxEventAgeSeconds_WhenMaxEventAgeSecondsAndThrottle
 }
 
 func TestValidate_MetricsNamePrefix_WhenEmpty(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	config := Config{}
 	err := config.Validate()
@@ -109,8 +136,7 @@ func TestValidate_MetricsNamePrefix_WhenEmpty(t *testing.T) {
 }
 
 func TestValidate_MetricsNamePrefix_WhenValid(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	validCases := []string{
 		"kubernetes_event_exporter_",
@@ -133,8 +159,7 @@ func TestValidate_MetricsNamePrefix_WhenValid(t *testing.T) {
 }
 
 func TestValidate_MetricsNamePrefix_WhenInvalid(t *testing.T) {
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 
 	invalidCases := []string{
 		"no_tracing_underscore",
@@ -211,6 +236,77 @@ receivers:
 	assert.Contains(t, err.Error(), "error parsing regexp")
 }
 
+func TestValidate_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name    string
+		yml     string
+		wantErr string
+	}{
+		{
+			name: "chain",
+			yml: `
+receivers:
+  - name: webhook
+    deadLetter: sqs
+    stdout: {}
+  - name: sqs
+    deadLetter: file
+    stdout: {}
+  - name: file
+    stdout: {}
+`,
+		},
+		{
+			name: "unknown",
+			yml: `
+receivers:
+  - name: webhook
+    deadLetter: missing
+    stdout: {}
+`,
+			wantErr: `unknown deadLetter receiver "missing"`,
+		},
+		{
+			name: "self",
+			yml: `
+receivers:
+  - name: webhook
+    deadLetter: webhook
+    stdout: {}
+`,
+			wantErr: "deadLetter cycle webhook -> webhook",
+		},
+		{
+			name: "cycle",
+			yml: `
+receivers:
+  - name: webhook
+    deadLetter: sqs
+    stdout: {}
+  - name: sqs
+    deadLetter: file
+    stdout: {}
+  - name: file
+    deadLetter: sqs
+    stdout: {}
+`,
+			wantErr: "deadLetter cycle webhook -> sqs -> file -> sqs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := readConfig(t, tt.yml)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
 func TestSetDefaults_MappingCacheSizeEnv(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -294,8 +390,7 @@ func TestSetDefaults_MappingCacheSizeEnv(t *testing.T) {
 				t.Setenv("MAPPING_CACHE_SIZE", *tt.envValue)
 			}
 
-			output := &bytes.Buffer{}
-			log.Logger = log.Logger.Output(output)
+			output := captureLogs(t)
 
 			config := tt.cfg
 			config.SetDefaults()
@@ -446,8 +541,8 @@ receivers:
 	assert.NotNil(t, cfg.Route.Drop[0].typePattern)
 	assert.Nil(t, cfg.Route.Drop[0].kindPattern) // Not set, should be nil
 
-	// Test top-level Match rules
-	assert.NotNil(t, cfg.Route.Match[0].receiverPattern)
+	// Test top-level Match rules, the receiver names are not patterns
+	assert.Nil(t, cfg.Route.Match[0].receiverNames)
 	assert.NotNil(t, cfg.Route.Match[0].kindPattern)
 
 	// Test nested route Drop rules
@@ -455,7 +550,7 @@ receivers:
 	assert.Equal(t, int32(6), cfg.Route.Routes[0].Drop[0].MinCount)
 
 	// Test nested route Match rules with labels and annotations
-	assert.NotNil(t, cfg.Route.Routes[0].Match[0].receiverPattern)
+	assert.Nil(t, cfg.Route.Routes[0].Match[0].receiverNames)
 	assert.NotNil(t, cfg.Route.Routes[0].Match[0].namespacePattern)
 	assert.NotNil(t, cfg.Route.Routes[0].Match[0].labelsPatterns)
 	assert.Len(t, cfg.Route.Routes[0].Match[0].labelsPatterns, 2)
@@ -545,8 +640,8 @@ receivers:
 
 	rule := cfg.Route.Match[0]
 
-	// Only receiver is set, all others should be nil
-	assert.NotNil(t, rule.receiverPattern)
+	// Only receiver is set, which is not a pattern, all others should be nil
+	assert.Nil(t, rule.receiverNames)
 	assert.Nil(t, rule.kindPattern)
 	assert.Nil(t, rule.namespacePattern)
 	assert.Nil(t, rule.typePattern)
@@ -554,3 +649,97 @@ receivers:
 	assert.Nil(t, rule.labelsPatterns)
 	assert.Nil(t, rule.annotationsPatterns)
 }
+
+func TestPreCompilePatterns_MatchExpressions(t *testing.T) {
+	const yml = `
+route:
+  match:
+    - receiver: stdout
+      matchExpressions:
+        - key: reason
+          operator: notIn
+          values: ["BackOff", "Pulling"]
+        - key: labels.team
+          operator: doesNotExist
+receivers:
+  - name: stdout
+    stdout: {}
+`
+	cfg := readConfig(t, yml)
+	require.NoError(t, cfg.PreCompilePatterns())
+	rule := &cfg.Route.Match[0]
+	require.Len(t, rule.expressions, 2)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = "Killing"
+	assert.True(t, rule.MatchesEvent(ev))
+	ev.InvolvedObject.Labels = map[string]string{"team": "payments"}
+	assert.False(t, rule.MatchesEvent(ev))
+}
+
+func TestReadConfig_ContinueAndReceivers(t *testing.T) {
+	const yml = `
+route:
+  routes:
+    - match:
+        - receiver: slack
+          receivers: [opsgenie, elastic]
+      continue: false
+    - match:
+        - receiver: dump
+receivers:
+  - name: slack
+    stdout: {}
+  - name: opsgenie
+    stdout: {}
+  - name: elastic
+    stdout: {}
+`
+	cfg := readConfig(t, yml)
+	require.NoError(t, cfg.PreCompilePatterns())
+	require.Len(t, cfg.Route.Routes, 2)
+	require.NotNil(t, cfg.Route.Routes[0].Continue)
+	assert.False(t, *cfg.Route.Routes[0].Continue)
+	assert.Nil(t, cfg.Route.Routes[1].Continue)
+	assert.Equal(t, []string{"slack", "opsgenie", "elastic"}, cfg.Route.Routes[0].Match[0].receivers(&kube.EnhancedEvent{}))
+
+	// The additional receivers must be configured
+	cfg.Receivers = cfg.Receivers[:2]
+	assert.ErrorContains(t, cfg.PreCompilePatterns(), `unknown receiver "elastic" in receivers`)
+}
+
+func TestReadConfig_ReceiverModes(t *testing.T) {
+	const yml = `
+route:
+  routes:
+    - match:
+        - receiver: "slack-.*"
+          receiverMode: regex
+        - receiver: "slack-{{ .Namespace }}"
+          receiverMode: template
+          defaultReceiver: slack-ops
+receivers:
+  - name: slack-ops
+    stdout: {}
+`
+	cfg := readConfig(t, yml)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, []string{"slack-ops"}, cfg.Route.Routes[0].Match[0].receivers(&kube.EnhancedEvent{}))
+	assert.Equal(t, "slack-ops", cfg.Route.Routes[0].Match[1].DefaultReceiver)
+}
+
+func TestValidate_ReceiverModes(t *testing.T) {
+	receivers := []sinks.ReceiverConfig{{Name: "slack"}}
+	for _, rule := range []Rule{
+		{Receiver: "slack", ReceiverMode: "glob"},
+		{Receiver: "slack", DefaultReceiver: "slack"},
+		{Receiver: "opsgenie-.*", ReceiverMode: ReceiverModeRegex},
+		{Receiver: "slack(", ReceiverMode: ReceiverModeRegex},
+		{ReceiverMode: ReceiverModeTemplate},
+		{Receiver: "{{ .Namespace", ReceiverMode: ReceiverModeTemplate},
+		{Receiver: "{{ .Namespace }}", ReceiverMode: ReceiverModeTemplate, DefaultReceiver: "dump"},
+	} {
+		cfg := Config{Route: Route{Match: []Rule{rule}}, Receivers: receivers}
+		assert.Error(t, cfg.PreCompilePatterns(), "rule %+v", rule)
+	}
+}
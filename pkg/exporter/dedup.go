@@ -0,0 +1,124 @@
+package exporter
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+)
+
+// deduplicator suppresses the repeats of events with the same fingerprint within the window of the last repeat.
+// While the repeats go on, a reminder carrying the number of suppressed repeats is let through every repeat
+// interval, if one is configured.
+type deduplicator struct {
+	entries   map[string]*dedupEntry
+	metrics   atomic.Pointer[metrics.Store]
+	now       func() time.Time
+	lastPrune time.Time
+	// name labels the metrics, it is the name of the receiver or the path of the route
+	name   string
+	fields []kube.FieldGetter
+	cfg    sinks.DedupConfig
+	mu     sync.Mutex
+}
+
+// dedupEntry is the state of a fingerprint
+type dedupEntry struct {
+	firstSeen  time.Time
+	lastSeen   time.Time
+	lastSent   time.Time
+	suppressed int
+}
+
+func newDeduplicator(name string, cfg sinks.DedupConfig) (*deduplicator, error) {
+	cfg.SetDefaults()
+	d := &deduplicator{
+		name:    name,
+		cfg:     cfg,
+		entries: make(map[string]*dedupEntry),
+		now:     time.Now,
+	}
+	for _, field := range cfg.Fields {
+		get, err := kube.CompileField(field)
+		if err != nil {
+			return nil, err
+		}
+		d.fields = append(d.fields, get)
+	}
+	return d, nil
+}
+
+// setMetricsStore makes the deduplicator count the suppressed events and reminders in the store
+func (d *deduplicator) setMetricsStore(store *metrics.Store) {
+	d.metrics.Store(store)
+}
+
+// fingerprint hashes the values of the configured fields of the event
+func (d *deduplicator) fingerprint(ev *kube.EnhancedEvent) string {
+	h := fnv.New64a()
+	for _, get := range d.fields {
+		v, _ := get(ev)
+		_, _ = h.Write([]byte(v))
+		// Separates the values, so that moving characters from one field to the next changes the fingerprint
+		_, _ = h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// check returns the event to send on: the event itself when it is not a repeat, a copy of it carrying the number
+// of suppressed repeats when it is a reminder, or nil when it is suppressed.
+func (d *deduplicator) check(ev *kube.EnhancedEvent) *kube.EnhancedEvent {
+	fp := d.fingerprint(ev)
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(now)
+
+	e := d.entries[fp]
+	if e == nil || now.Sub(e.lastSeen) > d.cfg.Window {
+		d.entries[fp] = &dedupEntry{firstSeen: now, lastSeen: now, lastSent: now}
+		return ev
+	}
+
+	e.lastSeen = now
+	if d.cfg.RepeatInterval > 0 && now.Sub(e.lastSent) >= d.cfg.RepeatInterval {
+		reminder := withDedup(ev, fp, e.suppressed, e.firstSeen)
+		e.lastSent = now
+		e.suppressed = 0
+		if store := d.metrics.Load(); store != nil {
+			store.DedupReminders.WithLabelValues(d.name).Inc()
+		}
+		return reminder
+	}
+
+	e.suppressed++
+	if store := d.metrics.Load(); store != nil {
+		store.EventsSuppressed.WithLabelValues(d.name).Inc()
+	}
+	return nil
+}
+
+// prune forgets the fingerprints which were not seen within the window, at most once per window
+func (d *deduplicator) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.cfg.Window {
+		return
+	}
+	d.lastPrune = now
+	for fp, e := range d.entries {
+		if now.Sub(e.lastSeen) > d.cfg.Window {
+			delete(d.entries, fp)
+		}
+	}
+}
+
+func withDedup(ev *kube.EnhancedEvent, fp string, suppressed int, firstSeen time.Time) *kube.EnhancedEvent {
+	c := *ev
+	c.Dedup = &kube.Dedup{Fingerprint: fp, Suppressed: suppressed, FirstSeen: firstSeen}
+	return &c
+}
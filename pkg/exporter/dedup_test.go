@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDeduplicator returns a deduplicator whose clock is advanced by the returned function
+func newTestDeduplicator(t *testing.T, cfg sinks.DedupConfig) (*deduplicator, func(time.Duration)) {
+	t.Helper()
+	d, err := newDeduplicator("test", cfg)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+	return d, func(step time.Duration) { now = now.Add(step) }
+}
+
+func dedupEvent(name, reason string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "default"
+	ev.Reason = reason
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Name = name
+	return ev
+}
+
+func TestDeduplicator_SuppressesRepeatsWithinWindow(t *testing.T) {
+	d, advance := newTestDeduplicator(t, sinks.DedupConfig{Window: time.Minute})
+
+	ev := dedupEvent("nginx", "BackOff")
+	assert.Same(t, ev, d.check(ev))
+	advance(30 * time.Second)
+	assert.Nil(t, d.check(dedupEvent("nginx", "BackOff")))
+	// Another object or reason has another fingerprint
+	assert.NotNil(t, d.check(dedupEvent("redis", "BackOff")))
+	assert.NotNil(t, d.check(dedupEvent("nginx", "Killing")))
+
+	// Every repeat extends the window
+	advance(50 * time.Second)
+	assert.Nil(t, d.check(dedupEvent("nginx", "BackOff")))
+	advance(61 * time.Second)
+	ev = dedupEvent("nginx", "BackOff")
+	assert.Same(t, ev, d.check(ev))
+	assert.Nil(t, ev.Dedup)
+}
+
+func TestDeduplicator_SendsRemindersWithSuppressedCount(t *testing.T) {
+	d, advance := newTestDeduplicator(t, sinks.DedupConfig{Window: time.Minute, RepeatInterval: 5 * time.Minute})
+	first := d.now()
+
+	require.NotNil(t, d.check(dedupEvent("nginx", "BackOff")))
+	for range 9 {
+		advance(30 * time.Second)
+		assert.Nil(t, d.check(dedupEvent("nginx", "BackOff")))
+	}
+
+	advance(30 * time.Second)
+	ev := dedupEvent("nginx", "BackOff")
+	reminder := d.check(ev)
+	require.NotNil(t, reminder)
+	require.NotNil(t, reminder.Dedup)
+	assert.Nil(t, ev.Dedup, "the original event is not modified")
+	assert.Equal(t, 9, reminder.Dedup.Suppressed)
+	assert.Equal(t, first, reminder.Dedup.FirstSeen)
+	assert.Equal(t, d.fingerprint(ev), reminder.Dedup.Fingerprint)
+
+	// The count starts over after a reminder
+	advance(30 * time.Second)
+	assert.Nil(t, d.check(dedupEvent("nginx", "BackOff")))
+}
+
+func TestDeduplicator_ConfiguredFields(t *testing.T) {
+	d, _ := newTestDeduplicator(t, sinks.DedupConfig{Fields: []string{"reason"}})
+
+	require.NotNil(t, d.check(dedupEvent("nginx", "BackOff")))
+	assert.Nil(t, d.check(dedupEvent("redis", "BackOff")))
+
+	_, err := newDeduplicator("test", sinks.DedupConfig{Fields: []string{"unknown"}})
+	assert.Error(t, err)
+}
+
+func TestDeduplicator_PrunesExpiredEntries(t *testing.T) {
+	d, advance := newTestDeduplicator(t, sinks.DedupConfig{Window: time.Minute})
+
+	d.check(dedupEvent("nginx", "BackOff"))
+	advance(2 * time.Minute)
+	d.check(dedupEvent("redis", "BackOff"))
+	assert.Len(t, d.entries, 1)
+}
+
+func TestRoute_Dedup(t *testing.T) {
+	cfg := Config{Route: Route{
+		Dedup: &sinks.DedupConfig{Window: time.Minute},
+		Match: []Rule{{Receiver: "dedup"}},
+	}}
+	require.NoError(t, cfg.PreCompilePatterns())
+	reg := testReceiverRegistry{}
+
+	cfg.Route.ProcessEvent(dedupEvent("nginx", "BackOff"), &reg)
+	cfg.Route.ProcessEvent(dedupEvent("nginx", "BackOff"), &reg)
+	cfg.Route.ProcessEvent(dedupEvent("redis", "BackOff"), &reg)
+	assert.Equal(t, 2, reg.count("dedup"))
+
+	// The events which match no rule of the route are not deduplicated, so they do not suppress the matching ones
+	cfg = Config{Route: Route{
+		Dedup: &sinks.DedupConfig{Window: time.Minute},
+		Match: []Rule{{Message: "^crashed$", Receiver: "crash"}},
+	}}
+	require.NoError(t, cfg.PreCompilePatterns())
+	ignored := dedupEvent("nginx", "BackOff")
+	ignored.Message = "restarted"
+	crashed := dedupEvent("nginx", "BackOff")
+	crashed.Message = "crashed"
+	cfg.Route.ProcessEvent(ignored, &reg)
+	cfg.Route.ProcessEvent(crashed, &reg)
+	assert.Equal(t, 1, reg.count("crash"))
+
+	cfg = Config{Route: Route{Routes: []Route{{Dedup: &sinks.DedupConfig{Fields: []string{"involvedObject.labels."}}}}}}
+	assert.ErrorContains(t, cfg.PreCompilePatterns(), "route.routes[0]")
+}
@@ -1,21 +1,79 @@
 package exporter
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/goccy/go-yaml"
 	"github.com/rs/zerolog/log"
 )
 
 // Engine is responsible for initializing the receivers from sinks
 type Engine struct {
 	Registry ReceiverRegistry
-	Route    Route
+	// Route is the route the events are processed with until the configuration is reloaded
+	Route Route
+	// Silences mute the matching events before they are routed, if set
+	Silences *Silencer
+	// Traces keeps the routing traces of the last events, if set
+	Traces *RouteTracer
+	// DryRun logs the routing decisions instead of sending the events to the registry
+	DryRun bool
+	// ShutdownTimeout bounds the time Stop waits for the receivers to deliver the pending events
+	ShutdownTimeout time.Duration
+	// started is the configuration the engine was created with, whose settings other than the reloadable ones keep
+	// running until a restart
+	started *Config
+	// reloaded is the route of the last reloaded configuration, if any
+	reloaded atomic.Pointer[Route]
+	// overrides applies the annotations of the involved objects, nil when they are disabled
+	overrides atomic.Pointer[annotationOverrides]
+	// processors transforms the events before they are silenced and routed
+	processors atomic.Pointer[processorChain]
+	// receivers holds the fingerprint of the configuration of every registered receiver
+	receivers map[string]string
+	// metricsStore is where the deduplicators of the routes count, if set
+	metricsStore *metrics.Store
+	stopped      atomic.Bool
+	reloadMu     sync.Mutex
 }
 
 func NewEngine(config *Config, registry ReceiverRegistry) *Engine {
+	e := &Engine{
+		Route:           config.Route,
+		Registry:        registry,
+		Silences:        NewSilencer(config.Silences),
+		DryRun:          config.DryRun,
+		ShutdownTimeout: config.ShutdownTimeout,
+	}
+	started := *config
+	e.started = &started
+	if config.RouteTraces > 0 {
+		e.Traces = NewRouteTracer(config.RouteTraces)
+	}
+	e.overrides.Store(newAnnotationOverrides(config.AnnotationOverrides))
+	processors, err := newProcessorChain(config.Processors)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot initialize processors")
+	}
+	e.processors.Store(&processors)
+	if config.DryRun {
+		log.Warn().Msg("Dry run: the routing decisions are logged, no event is sent")
+		return e
+	}
+
+	receivers := make(map[string]string, len(config.Receivers))
 	for i := range config.Receivers {
 		v := &config.Receivers[i]
+		receivers[v.Name] = receiverFingerprint(v)
 		sink, err := v.GetSink()
 		if err != nil {
 			log.Fatal().Err(err).Str("name", v.Name).Msg("Cannot initialize sink")
@@ -26,23 +84,217 @@ func NewEngine(config *Config, registry ReceiverRegistry) *Engine {
 			Str("type", reflect.TypeOf(sink).String()).
 			Msg("Registering sink")
 
-		registry.Register(v.Name, sink)
+		if err := registry.Register(v.Name, sink, v); err != nil {
+			log.Fatal().Err(err).Str("name", v.Name).Msg("Cannot register sink")
+		}
 	}
+	e.receivers = receivers
+	return e
+}
 
-	return &Engine{
-		Route:    config.Route,
-		Registry: registry,
+// SetMetricsStore makes the routes count the events they suppress in the store, including the routes of the
+// configurations reloaded later, and the silences the events they mute
+func (e *Engine) SetMetricsStore(store *metrics.Store) {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	e.metricsStore = store
+	if e.Silences != nil {
+		e.Silences.SetMetricsStore(store)
+	}
+	e.Route.setMetricsStore(store)
+	if route := e.reloaded.Load(); route != nil {
+		route.setMetricsStore(store)
 	}
 }
 
 // OnEvent does not care whether event is add or update. Prior filtering should be done in the controller/watcher
 func (e *Engine) OnEvent(event *kube.EnhancedEvent) {
-	e.Route.ProcessEvent(event, e.Registry)
+	if e.stopped.Load() {
+		log.Debug().Str("event", event.Message).Msg("Engine is stopped, ignoring event")
+		return
+	}
+	// The processors run first, so that the traces do not reveal what they redact
+	if processors := e.processors.Load(); processors != nil {
+		event = processors.process(event)
+	}
+	var trace *RouteTrace
+	if e.Traces != nil || e.DryRun {
+		trace = newRouteTrace(event)
+		trace.DryRun = e.DryRun
+		defer e.recordTrace(trace)
+	}
+	if e.Silences != nil {
+		if id := e.Silences.silencedBy(event); id != "" {
+			log.Debug().Str("event", event.Message).Str("silence", id).Msg("Event is silenced")
+			if trace != nil {
+				trace.Silence = id
+			}
+			return
+		}
+	}
+	overrides := e.overrides.Load()
+	if overrides != nil {
+		if key := overrides.ignoredBy(event); key != "" {
+			log.Debug().Str("event", event.Message).Str("annotation", key).Msg("Event is ignored by annotation")
+			if trace != nil {
+				trace.IgnoredBy = key
+			}
+			return
+		}
+	}
+	route := e.reloaded.Load()
+	if route == nil {
+		route = &e.Route
+	}
+	var registry ReceiverRegistry = e.Registry
+	if e.DryRun {
+		registry = dryRunRegistry{}
+	}
+
+	var added []string
+	if overrides != nil {
+		added = overrides.receivers(event)
+	}
+	if len(added) == 0 {
+		route.processEvent(event, registry, trace, "route")
+		return
+	}
+	// The receivers added by annotation get the event after the routes, unless a route sent it to them already
+	recording := &recordingRegistry{ReceiverRegistry: registry, sent: make(map[string]struct{})}
+	route.processEvent(event, recording, trace, "route")
+	added = slices.DeleteFunc(added, func(name string) bool {
+		_, sent := recording.sent[name]
+		return sent
+	})
+	for _, name := range added {
+		registry.SendEvent(name, event)
+	}
+	if trace != nil && len(added) > 0 {
+		trace.add(RouteStep{Route: "annotations", Rule: AnnotationReceivers, Result: StepMatched, Receivers: added})
+	}
 }
 
-// Stop stops all registered sinks
+// recordTrace keeps the routing trace, and logs it in dry-run mode
+func (e *Engine) recordTrace(trace *RouteTrace) {
+	if e.Traces != nil {
+		e.Traces.record(trace)
+	}
+	if e.DryRun {
+		log.Info().EmbedObject(trace).Msg("Dry run: routing decision")
+	}
+}
+
+// Reload applies the receivers, the processors, the route and the silences of a new configuration, which must be
+// validated already. The receivers whose configuration did not change keep running, changed ones are replaced and new
+// ones registered before the route is swapped. Removed receivers are unregistered afterwards. If a sink or a processor
+// cannot be initialized, the configuration is rejected and nothing changes. If a receiver cannot be registered, the
+// configuration is rejected as well and the route is kept, only the receivers registered before it were changed.
+func (e *Engine) Reload(config *Config) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	processors, err := newProcessorChain(config.Processors)
+	if err != nil {
+		return err
+	}
+	if e.started != nil {
+		if changed := config.restartRequired(e.started); len(changed) > 0 {
+			log.Warn().Strs("settings", changed).Msg("Changed settings are not reloaded, they take effect on restart")
+		}
+	}
+	if e.DryRun {
+		e.swapRoute(config, processors)
+		return nil
+	}
+
+	type change struct {
+		cfg  *sinks.ReceiverConfig
+		sink sinks.Sink
+	}
+	var changes []change
+	receivers := make(map[string]string, len(config.Receivers))
+	for i := range config.Receivers {
+		v := &config.Receivers[i]
+		receivers[v.Name] = receiverFingerprint(v)
+		if fp, ok := e.receivers[v.Name]; ok && fp != "" && fp == receivers[v.Name] {
+			continue
+		}
+		sink, err := v.GetSink()
+		if err != nil {
+			for _, c := range changes {
+				c.sink.Close()
+			}
+			return fmt.Errorf("cannot initialize sink of receiver %q: %w", v.Name, err)
+		}
+		changes = append(changes, change{cfg: v, sink: sink})
+	}
+
+	for i, c := range changes {
+		log.Info().
+			Str("name", c.cfg.Name).
+			Str("type", reflect.TypeOf(c.sink).String()).
+			Msg("Registering sink")
+		if err := e.Registry.Register(c.cfg.Name, c.sink, c.cfg); err != nil {
+			for _, rest := range changes[i:] {
+				rest.sink.Close()
+			}
+			return fmt.Errorf("cannot register receiver %q: %w", c.cfg.Name, err)
+		}
+		if e.receivers == nil {
+			e.receivers = make(map[string]string)
+		}
+		e.receivers[c.cfg.Name] = receivers[c.cfg.Name]
+	}
+	e.swapRoute(config, processors)
+	for name := range e.receivers {
+		if _, ok := receivers[name]; !ok {
+			e.Registry.Unregister(name)
+		}
+	}
+	e.receivers = receivers
+	return nil
+}
+
+// swapRoute applies the route, the annotation overrides and the silences of the config, and the processors compiled
+// from it. The deduplicators of the current route are kept where their config did not change.
+func (e *Engine) swapRoute(config *Config, processors processorChain) {
+	route := config.Route
+	previous := e.reloaded.Load()
+	if previous == nil {
+		previous = &e.Route
+	}
+	route.keepDedup(previous)
+	if e.metricsStore != nil {
+		route.setMetricsStore(e.metricsStore)
+	}
+	e.reloaded.Store(&route)
+	e.overrides.Store(newAnnotationOverrides(config.AnnotationOverrides))
+	e.processors.Store(&processors)
+	if e.Silences != nil {
+		e.Silences.setConfigured(config.Silences)
+	}
+}
+
+// receiverFingerprint identifies the configuration of a receiver, to find out whether a reload changed it
+func receiverFingerprint(cfg *sinks.ReceiverConfig) string {
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		// Cannot tell whether it changed, so it is replaced
+		return ""
+	}
+	return string(b)
+}
+
+// Stop stops accepting events, then waits for the registered sinks to deliver the pending events and closes them
 func (e *Engine) Stop() {
-	log.Info().Msg("Closing sinks")
-	e.Registry.Close()
+	e.stopped.Store(true)
+
+	ctx := context.Background()
+	if e.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.ShutdownTimeout)
+		defer cancel()
+	}
+	log.Info().Dur("timeout", e.ShutdownTimeout).Msg("Closing sinks")
+	e.Registry.Close(ctx)
 	log.Info().Msg("All sinks closed")
 }
@@ -1,10 +1,16 @@
 package exporter
 
 import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/spool"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEngineNoRoutes(t *testing.T) {
@@ -63,3 +69,100 @@ func TestEngineDropSimple(t *testing.T) {
 	assert.NotContains(t, config.Ref.Events, ev)
 	assert.Empty(t, config.Ref.Events)
 }
+
+func TestEngine_StopsIntake(t *testing.T) {
+	reg := &testReceiverRegistry{}
+	e := &Engine{
+		Registry: reg,
+		Route:    Route{Match: []Rule{{Receiver: "stdout"}}},
+	}
+
+	e.OnEvent(&kube.EnhancedEvent{})
+	e.Stop()
+	e.OnEvent(&kube.EnhancedEvent{})
+
+	assert.Equal(t, 1, reg.count("stdout"))
+}
+
+func TestEngine_Reload(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	cfg := &Config{
+		Route: Route{Match: []Rule{{Receiver: "kept"}, {Receiver: "removed"}}},
+		Receivers: []sinks.ReceiverConfig{
+			{Name: "kept", InMemory: &sinks.InMemoryConfig{}},
+			{Name: "removed", InMemory: &sinks.InMemoryConfig{}},
+		},
+	}
+	e := NewEngine(cfg, reg)
+	kept := reg.receivers["kept"]
+	removed := cfg.Receivers[1].InMemory.Ref
+
+	reloaded := &Config{
+		Route: Route{Match: []Rule{{Receiver: "kept"}, {Receiver: "added"}}},
+		Receivers: []sinks.ReceiverConfig{
+			{Name: "kept", InMemory: &sinks.InMemoryConfig{}},
+			{Name: "added", InMemory: &sinks.InMemoryConfig{}},
+		},
+	}
+	require.NoError(t, e.Reload(reloaded))
+	e.OnEvent(eventWithMessage("after reload"))
+
+	// A sink which cannot be initialized rejects the whole config
+	invalid := &Config{
+		Route:     Route{Match: []Rule{{Receiver: "broken"}}},
+		Receivers: []sinks.ReceiverConfig{{Name: "broken"}},
+	}
+	require.Error(t, e.Reload(invalid))
+
+	// So does a spool which cannot be opened
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	unspoolable := &Config{
+		Route: Route{Match: []Rule{{Receiver: "spooled"}}},
+		Receivers: []sinks.ReceiverConfig{
+			{Name: "kept", InMemory: &sinks.InMemoryConfig{}},
+			{Name: "spooled", InMemory: &sinks.InMemoryConfig{}, Spool: &spool.Config{Dir: file}},
+		},
+	}
+	require.ErrorContains(t, e.Reload(unspoolable), "cannot open spool")
+	assert.NotContains(t, reg.receivers, "spooled")
+	e.OnEvent(eventWithMessage("after rejected reload"))
+
+	assert.Same(t, kept, reg.receivers["kept"])
+	assert.NotContains(t, reg.receivers, "removed")
+	e.Stop()
+
+	assert.Len(t, cfg.Receivers[0].InMemory.Ref.Events, 2)
+	assert.Len(t, reloaded.Receivers[1].InMemory.Ref.Events, 2)
+	assert.Empty(t, removed.Events)
+}
+
+func TestEngine_ReloadKeepsDedupAndWarnsOfRestart(t *testing.T) {
+	logs := captureLogs(t)
+	reg := &testReceiverRegistry{}
+	route := func(window time.Duration) Route {
+		return Route{Routes: []Route{{
+			Dedup: &sinks.DedupConfig{Window: window},
+			Match: []Rule{{Receiver: "slack"}},
+		}}}
+	}
+	cfg := &Config{Route: route(time.Hour)}
+	require.NoError(t, cfg.PreCompilePatterns())
+	e := NewEngine(cfg, reg)
+	e.OnEvent(dedupEvent("nginx", "BackOff"))
+
+	// The repeats suppressed before the reload stay suppressed, the settings needing a restart are reported
+	reloaded := &Config{Route: route(time.Hour), ClusterName: "prod", RouteTraces: 10}
+	require.NoError(t, reloaded.PreCompilePatterns())
+	require.NoError(t, e.Reload(reloaded))
+	e.OnEvent(dedupEvent("nginx", "BackOff"))
+	assert.Equal(t, 1, reg.count("slack"))
+	assert.Contains(t, logs.String(), `"settings":["clusterName","routeTraces"]`)
+
+	// A changed dedup config starts over
+	changed := &Config{Route: route(2 * time.Hour)}
+	require.NoError(t, changed.PreCompilePatterns())
+	require.NoError(t, e.Reload(changed))
+	e.OnEvent(dedupEvent("nginx", "BackOff"))
+	assert.Equal(t, 2, reg.count("slack"))
+}
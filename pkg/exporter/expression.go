@@ -0,0 +1,118 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+)
+
+// Operators of a match expression
+const (
+	// OperatorMatch requires the field to exist and match the regular expression of the single value
+	OperatorMatch = "match"
+	// OperatorNotMatch requires the field not to exist or not to match the regular expression of the single value
+	OperatorNotMatch = "notMatch"
+	// OperatorIn requires the field to exist and to equal one of the values
+	OperatorIn = "in"
+	// OperatorNotIn requires the field not to exist or to equal none of the values
+	OperatorNotIn = "notIn"
+	// OperatorExists requires the field to exist, it takes no values
+	OperatorExists = "exists"
+	// OperatorDoesNotExist requires the field not to exist, it takes no values
+	OperatorDoesNotExist = "doesNotExist"
+)
+
+// ruleFieldPaths maps the names of the fields of a rule to the fields of the event they match
+var ruleFieldPaths = map[string]string{
+	"apiVersion":  "involvedObject.apiVersion",
+	"kind":        "involvedObject.kind",
+	"component":   "source.component",
+	"host":        "source.host",
+	"ownerKind":   "involvedObject.owner.kind",
+	"ownerName":   "involvedObject.owner.name",
+	"name":        "involvedObject.name",
+	"fieldPath":   "involvedObject.fieldPath",
+	"relatedKind": "related.kind",
+	"relatedName": "related.name",
+}
+
+// MatchExpression matches a field of the event with an operator, like the expressions of a Kubernetes label
+// selector. The key is the name of a field of the rule, e.g. "reason", "labels.team", "annotations.owner",
+// "namespaceLabels.tier" or "fields.exitCode", or a field of the event, e.g. "involvedObject.name". Labels, annotations
+// and custom fields exist when the event has them, the other fields when they are not empty.
+type MatchExpression struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// expressionMatcher is a compiled match expression
+type expressionMatcher struct {
+	get      kube.FieldGetter
+	pattern  *regexp.Regexp
+	operator string
+	values   []string
+}
+
+// compileExpression validates the expression and compiles its key and regular expression
+func compileExpression(e MatchExpression) (*expressionMatcher, error) {
+	path := e.Key
+	if p, ok := ruleFieldPaths[path]; ok {
+		path = p
+	} else if key, ok := strings.CutPrefix(path, "labels."); ok {
+		path = "involvedObject.labels." + key
+	} else if key, ok := strings.CutPrefix(path, "annotations."); ok {
+		path = "involvedObject.annotations." + key
+	}
+	get, err := kube.CompileField(path)
+	if err != nil {
+		return nil, fmt.Errorf("matchExpressions: %w", err)
+	}
+
+	m := &expressionMatcher{get: get, operator: e.Operator, values: e.Values}
+	switch e.Operator {
+	case OperatorMatch, OperatorNotMatch:
+		if len(e.Values) != 1 {
+			return nil, fmt.Errorf("matchExpressions: key %q: operator %s takes a single value, got %d", e.Key, e.Operator, len(e.Values))
+		}
+		m.pattern, err = regexp.Compile(e.Values[0])
+		if err != nil {
+			return nil, fmt.Errorf("matchExpressions: key %q: %w", e.Key, err)
+		}
+	case OperatorIn, OperatorNotIn:
+		if len(e.Values) == 0 {
+			return nil, fmt.Errorf("matchExpressions: key %q: operator %s needs values", e.Key, e.Operator)
+		}
+	case OperatorExists, OperatorDoesNotExist:
+		if len(e.Values) != 0 {
+			return nil, fmt.Errorf("matchExpressions: key %q: operator %s takes no values", e.Key, e.Operator)
+		}
+	default:
+		return nil, fmt.Errorf("matchExpressions: key %q: operator must be one of %s, %s, %s, %s, %s or %s, got %q",
+			e.Key, OperatorMatch, OperatorNotMatch, OperatorIn, OperatorNotIn, OperatorExists, OperatorDoesNotExist, e.Operator)
+	}
+	return m, nil
+}
+
+func (m *expressionMatcher) matches(ev *kube.EnhancedEvent) bool {
+	v, ok := m.get(ev)
+	switch m.operator {
+	case OperatorMatch:
+		return ok && m.pattern.MatchString(v)
+	case OperatorNotMatch:
+		return !ok || !m.pattern.MatchString(v)
+	case OperatorIn:
+		return ok && slices.Contains(m.values, v)
+	case OperatorNotIn:
+		return !ok || !slices.Contains(m.values, v)
+	case OperatorExists:
+		return ok
+	case OperatorDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
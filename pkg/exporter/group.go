@@ -0,0 +1,219 @@
+package exporter
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+)
+
+// grouper gathers the events of a receiver into groups by the values of the grouping fields, and sends a
+// notification for every group: groupWait after its first event, then every groupInterval when events joined it, or
+// every repeatInterval when none did. Events leave their group once they were not updated for the resolve timeout.
+type grouper struct {
+	groups map[string]*eventGroup
+	// send hands a notification to the receiver
+	send   func(ev *kube.EnhancedEvent)
+	now    func() time.Time
+	fields []kube.FieldGetter
+	cfg    sinks.GroupConfig
+	// stopped is set once the pending notifications are sent on closing, later events are sent right away
+	stopped bool
+	mu      sync.Mutex
+}
+
+// eventGroup is the state of a group of events
+type eventGroup struct {
+	timer    *time.Timer
+	labels   map[string]string
+	latest   *kube.EnhancedEvent
+	lastSent time.Time
+	// events holds the events of the group in the order they joined, up to the max events
+	events []groupedEvent
+	// omitted holds when the events beyond the max events were last seen, by id, so that they are counted until they
+	// resolve without keeping them
+	omitted map[string]time.Time
+	// anonymous numbers the omitted events without id
+	anonymous int
+	// changed is set when an event joined the group since the last notification
+	changed bool
+}
+
+type groupedEvent struct {
+	lastSeen time.Time
+	id       string
+	event    kube.EnhancedEvent
+}
+
+func newGrouper(cfg sinks.GroupConfig, send func(ev *kube.EnhancedEvent)) (*grouper, error) {
+	cfg.SetDefaults()
+	g := &grouper{
+		cfg:    cfg,
+		send:   send,
+		groups: make(map[string]*eventGroup),
+		now:    time.Now,
+	}
+	for _, field := range cfg.By {
+		get, err := kube.CompileField(field)
+		if err != nil {
+			return nil, err
+		}
+		g.fields = append(g.fields, get)
+	}
+	return g, nil
+}
+
+// groupOf returns the key and the labels of the group of the event, the key lists the labels like
+// {namespace="default", reason="BackOff"}
+func (g *grouper) groupOf(ev *kube.EnhancedEvent) (string, map[string]string) {
+	labels := make(map[string]string, len(g.fields))
+	pairs := make([]string, 0, len(g.fields))
+	for i, get := range g.fields {
+		v, _ := get(ev)
+		labels[g.cfg.By[i]] = v
+		pairs = append(pairs, g.cfg.By[i]+"="+strconv.Quote(v))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}", labels
+}
+
+// add puts the event into its group. An event which is in the group already, the same event object updated with a
+// new count, replaces its previous version without making the group send a notification.
+func (g *grouper) add(ev *kube.EnhancedEvent) {
+	key, labels := g.groupOf(ev)
+	now := g.now()
+
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		g.send(ev)
+		return
+	}
+	grp := g.groups[key]
+	if grp == nil {
+		grp = &eventGroup{labels: labels}
+		g.groups[key] = grp
+		grp.timer = time.AfterFunc(g.cfg.GroupWait, func() { g.flush(key) })
+	}
+	grp.add(ev, now, g.cfg.MaxEvents)
+	g.mu.Unlock()
+}
+
+// flush sends the notification of the group if it is due, and schedules the next one
+func (g *grouper) flush(key string) {
+	g.mu.Lock()
+	grp := g.groups[key]
+	if g.stopped || grp == nil {
+		g.mu.Unlock()
+		return
+	}
+	now := g.now()
+	grp.resolve(now.Add(-g.cfg.ResolveTimeout))
+	if len(grp.events) == 0 && len(grp.omitted) == 0 {
+		delete(g.groups, key)
+		g.mu.Unlock()
+		return
+	}
+	var notification *kube.EnhancedEvent
+	if grp.changed || now.Sub(grp.lastSent) >= g.cfg.RepeatInterval {
+		notification = grp.notify(key, now)
+	}
+	grp.timer.Reset(g.cfg.GroupInterval)
+	g.mu.Unlock()
+
+	if notification != nil {
+		g.send(notification)
+	}
+}
+
+// stop sends the notifications of the groups which events joined since their last one, without waiting for their
+// timers. The events added later are sent on right away.
+func (g *grouper) stop() {
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		return
+	}
+	g.stopped = true
+	var notifications []*kube.EnhancedEvent
+	now := g.now()
+	for key, grp := range g.groups {
+		grp.timer.Stop()
+		if grp.changed {
+			notifications = append(notifications, grp.notify(key, now))
+		}
+	}
+	clear(g.groups)
+	g.mu.Unlock()
+
+	for _, n := range notifications {
+		g.send(n)
+	}
+}
+
+// add puts the event into the group. Once the group lists maxEvents events, new events are only counted as omitted;
+// an omitted event is listed when it is updated after listed events resolved.
+func (grp *eventGroup) add(ev *kube.EnhancedEvent, now time.Time, maxEvents int) {
+	c := *ev
+	grp.latest = &c
+	id := string(ev.UID)
+	if id == "" && ev.Name != "" {
+		id = ev.Namespace + "/" + ev.Name
+	}
+	if id != "" {
+		if i := slices.IndexFunc(grp.events, func(e groupedEvent) bool { return e.id == id }); i >= 0 {
+			grp.events[i].event = c
+			grp.events[i].lastSeen = now
+			return
+		}
+		if _, ok := grp.omitted[id]; ok {
+			if len(grp.events) >= maxEvents {
+				grp.omitted[id] = now
+				return
+			}
+			delete(grp.omitted, id)
+			grp.events = append(grp.events, groupedEvent{id: id, event: c, lastSeen: now})
+			return
+		}
+	}
+	grp.changed = true
+	if len(grp.events) >= maxEvents {
+		if id == "" {
+			grp.anonymous++
+			id = "#" + strconv.Itoa(grp.anonymous)
+		}
+		if grp.omitted == nil {
+			grp.omitted = make(map[string]time.Time)
+		}
+		grp.omitted[id] = now
+		return
+	}
+	grp.events = append(grp.events, groupedEvent{id: id, event: c, lastSeen: now})
+}
+
+// resolve removes the events which were not updated since the given time
+func (grp *eventGroup) resolve(since time.Time) {
+	grp.events = slices.DeleteFunc(grp.events, func(e groupedEvent) bool {
+		return e.lastSeen.Before(since)
+	})
+	maps.DeleteFunc(grp.omitted, func(_ string, lastSeen time.Time) bool {
+		return lastSeen.Before(since)
+	})
+}
+
+// notify returns the notification of the group, which is its latest event listing all its events
+func (grp *eventGroup) notify(key string, now time.Time) *kube.EnhancedEvent {
+	grp.changed = false
+	grp.lastSent = now
+	events := make([]kube.EnhancedEvent, len(grp.events))
+	for i := range grp.events {
+		events[i] = grp.events[i].event
+	}
+	n := *grp.latest
+	n.Group = &kube.Group{Key: key, Labels: grp.labels, Events: events, Omitted: len(grp.omitted)}
+	return &n
+}
@@ -0,0 +1,172 @@
+package exporter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// notificationRecorder records the notifications of a grouper
+type notificationRecorder struct {
+	sent []*kube.EnhancedEvent
+	mu   sync.Mutex
+}
+
+func (n *notificationRecorder) send(ev *kube.EnhancedEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, ev)
+}
+
+func (n *notificationRecorder) notifications() []*kube.EnhancedEvent {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*kube.EnhancedEvent(nil), n.sent...)
+}
+
+func groupEvent(uid types.UID, namespace, msg string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.UID = uid
+	ev.Namespace = namespace
+	ev.Message = msg
+	return ev
+}
+
+func TestGrouper_SendsOneNotificationPerGroup(t *testing.T) {
+	rec := &notificationRecorder{}
+	g, err := newGrouper(sinks.GroupConfig{
+		By:            []string{"namespace"},
+		GroupWait:     50 * time.Millisecond,
+		GroupInterval: time.Hour,
+	}, rec.send)
+	require.NoError(t, err)
+
+	g.add(groupEvent("1", "default", "first"))
+	g.add(groupEvent("2", "default", "second"))
+	// An update of an event replaces it in its group
+	g.add(groupEvent("1", "default", "first again"))
+	g.add(groupEvent("3", "kube-system", "other"))
+	assert.Empty(t, rec.notifications())
+
+	require.Eventually(t, func() bool { return len(rec.notifications()) == 2 }, time.Second, 10*time.Millisecond)
+	byKey := map[string]*kube.EnhancedEvent{}
+	for _, n := range rec.notifications() {
+		require.NotNil(t, n.Group)
+		byKey[n.Group.Key] = n
+	}
+
+	n := byKey[`{namespace="default"}`]
+	require.NotNil(t, n)
+	assert.Equal(t, map[string]string{"namespace": "default"}, n.Group.Labels)
+	assert.Equal(t, "first again", n.Message, "the notification is the latest event")
+	require.Len(t, n.Group.Events, 2)
+	assert.Equal(t, "first again", n.Group.Events[0].Message)
+	assert.Equal(t, "second", n.Group.Events[1].Message)
+	assert.Len(t, byKey[`{namespace="kube-system"}`].Group.Events, 1)
+}
+
+func TestGrouper_NotifiesOnChangesAndRepeats(t *testing.T) {
+	rec := &notificationRecorder{}
+	g, err := newGrouper(sinks.GroupConfig{
+		GroupWait:      10 * time.Millisecond,
+		GroupInterval:  30 * time.Millisecond,
+		RepeatInterval: time.Hour,
+		ResolveTimeout: time.Hour,
+	}, rec.send)
+	require.NoError(t, err)
+	defer g.stop()
+
+	g.add(groupEvent("1", "default", "first"))
+	require.Eventually(t, func() bool { return len(rec.notifications()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Without a new event, nothing is sent before the repeat interval
+	g.add(groupEvent("1", "default", "first again"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, rec.notifications(), 1)
+
+	g.add(groupEvent("2", "default", "second"))
+	require.Eventually(t, func() bool { return len(rec.notifications()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, rec.notifications()[1].Group.Events, 2)
+
+	g.mu.Lock()
+	g.cfg.RepeatInterval = 0
+	g.mu.Unlock()
+	require.Eventually(t, func() bool { return len(rec.notifications()) > 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestGrouper_ForgetsResolvedEvents(t *testing.T) {
+	rec := &notificationRecorder{}
+	g, err := newGrouper(sinks.GroupConfig{
+		GroupWait:      10 * time.Millisecond,
+		GroupInterval:  10 * time.Millisecond,
+		RepeatInterval: time.Nanosecond,
+		ResolveTimeout: 30 * time.Millisecond,
+	}, rec.send)
+	require.NoError(t, err)
+
+	g.add(groupEvent("1", "default", "first"))
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return len(g.groups) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.NotEmpty(t, rec.notifications())
+}
+
+func TestGrouper_CapsEvents(t *testing.T) {
+	rec := &notificationRecorder{}
+	g, err := newGrouper(sinks.GroupConfig{GroupWait: time.Hour, MaxEvents: 2}, rec.send)
+	require.NoError(t, err)
+	start := time.Now()
+	now := start
+	g.now = func() time.Time { return now }
+
+	g.add(groupEvent("1", "default", "first"))
+	g.add(groupEvent("2", "default", "second"))
+	g.add(groupEvent("3", "default", "third"))
+	g.add(groupEvent("4", "default", "fourth"))
+	// An update of an omitted event is not counted twice
+	now = start.Add(time.Minute)
+	g.add(groupEvent("3", "default", "third again"))
+
+	grp := g.groups[`{}`]
+	require.NotNil(t, grp)
+	n := grp.notify(`{}`, now)
+	assert.Equal(t, "third again", n.Message)
+	require.Len(t, n.Group.Events, 2)
+	assert.Equal(t, "first", n.Group.Events[0].Message)
+	assert.Equal(t, "second", n.Group.Events[1].Message)
+	assert.Equal(t, 2, n.Group.Omitted)
+
+	// Once listed events resolve, an updated omitted event is listed
+	grp.resolve(start.Add(time.Second))
+	g.add(groupEvent("3", "default", "third listed"))
+	assert.False(t, grp.changed, "an omitted event joined the group already")
+	n = grp.notify(`{}`, now)
+	require.Len(t, n.Group.Events, 1)
+	assert.Equal(t, "third listed", n.Group.Events[0].Message)
+	assert.Zero(t, n.Group.Omitted)
+	g.stop()
+}
+
+func TestGrouper_StopSendsPendingNotifications(t *testing.T) {
+	rec := &notificationRecorder{}
+	g, err := newGrouper(sinks.GroupConfig{GroupWait: time.Hour}, rec.send)
+	require.NoError(t, err)
+
+	g.add(groupEvent("1", "default", "first"))
+	g.stop()
+	require.Len(t, rec.notifications(), 1)
+	assert.Len(t, rec.notifications()[0].Group.Events, 1)
+
+	// Events are sent on right away once stopped
+	g.add(groupEvent("2", "default", "late"))
+	require.Len(t, rec.notifications(), 2)
+	assert.Nil(t, rec.notifications()[1].Group)
+}
@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/rs/zerolog/log"
+)
+
+// Annotations of the involved objects which override the routing of their events
+const (
+	// AnnotationReceivers adds the comma-separated receivers to the receivers of the events
+	AnnotationReceivers = "event-exporter.io/receivers"
+	// AnnotationIgnore drops all the events when it is true
+	AnnotationIgnore = "event-exporter.io/ignore"
+	// AnnotationIgnoreReasons drops the events with one of the comma-separated reasons
+	AnnotationIgnoreReasons = "event-exporter.io/ignore-reasons"
+)
+
+// AnnotationOverridesConfig lets the annotations of the involved objects add receivers to their events or drop them
+type AnnotationOverridesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedReceivers are the receivers the annotations may add, the other ones are ignored
+	AllowedReceivers []string `yaml:"allowedReceivers"`
+}
+
+// validate checks that the allowed receivers are configured
+func (c *AnnotationOverridesConfig) validate(receivers []sinks.ReceiverConfig) error {
+	for _, name := range c.AllowedReceivers {
+		if !slices.ContainsFunc(receivers, func(r sinks.ReceiverConfig) bool { return r.Name == name }) {
+			return fmt.Errorf("annotationOverrides: unknown allowed receiver %q", name)
+		}
+	}
+	return nil
+}
+
+// annotationOverrides applies the annotations of the involved objects, it is nil when they are disabled
+type annotationOverrides struct {
+	allowed map[string]struct{}
+}
+
+func newAnnotationOverrides(cfg AnnotationOverridesConfig) *annotationOverrides {
+	if !cfg.Enabled {
+		return nil
+	}
+	o := &annotationOverrides{allowed: make(map[string]struct{}, len(cfg.AllowedReceivers))}
+	for _, name := range cfg.AllowedReceivers {
+		o.allowed[name] = struct{}{}
+	}
+	return o
+}
+
+// ignoredBy returns the annotation which drops the event, empty if none does
+func (o *annotationOverrides) ignoredBy(ev *kube.EnhancedEvent) string {
+	annotations := ev.InvolvedObject.Annotations
+	if v, ok := annotations[AnnotationIgnore]; ok {
+		ignore, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			log.Debug().Str("value", v).Msgf("Invalid %s annotation, expected a boolean", AnnotationIgnore)
+		}
+		if ignore {
+			return AnnotationIgnore
+		}
+	}
+	for reason := range strings.SplitSeq(annotations[AnnotationIgnoreReasons], ",") {
+		if reason = strings.TrimSpace(reason); reason != "" && strings.EqualFold(reason, ev.Reason) {
+			return AnnotationIgnoreReasons
+		}
+	}
+	return ""
+}
+
+// receivers returns the allowed receivers the annotation adds to the event
+func (o *annotationOverrides) receivers(ev *kube.EnhancedEvent) []string {
+	v, ok := ev.InvolvedObject.Annotations[AnnotationReceivers]
+	if !ok {
+		return nil
+	}
+	var receivers []string
+	for name := range strings.SplitSeq(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(receivers, name) {
+			continue
+		}
+		if _, ok := o.allowed[name]; !ok {
+			log.Debug().
+				Str("receiver", name).
+				Str("object", ev.InvolvedObject.Namespace+"/"+ev.InvolvedObject.Name).
+				Msgf("Receiver of the %s annotation is not allowed, ignoring it", AnnotationReceivers)
+			continue
+		}
+		receivers = append(receivers, name)
+	}
+	return receivers
+}
+
+// recordingRegistry records the receivers the route sends an event to, so that the receivers added by the
+// annotations do not get it twice
+type recordingRegistry struct {
+	ReceiverRegistry
+	sent map[string]struct{}
+}
+
+func (r *recordingRegistry) SendEvent(name string, ev *kube.EnhancedEvent) {
+	r.sent[name] = struct{}{}
+	r.ReceiverRegistry.SendEvent(name, ev)
+}
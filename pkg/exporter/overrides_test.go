@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func annotatedEvent(reason string, annotations map[string]string) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = reason
+	ev.InvolvedObject.Annotations = annotations
+	return ev
+}
+
+func TestAnnotationOverrides_Ignore(t *testing.T) {
+	o := newAnnotationOverrides(AnnotationOverridesConfig{Enabled: true})
+
+	assert.Equal(t, AnnotationIgnore, o.ignoredBy(annotatedEvent("BackOff", map[string]string{AnnotationIgnore: "true"})))
+	assert.Empty(t, o.ignoredBy(annotatedEvent("BackOff", map[string]string{AnnotationIgnore: "false"})))
+	assert.Empty(t, o.ignoredBy(annotatedEvent("BackOff", map[string]string{AnnotationIgnore: "yes please"})))
+
+	reasons := map[string]string{AnnotationIgnoreReasons: "Unhealthy, backoff"}
+	assert.Equal(t, AnnotationIgnoreReasons, o.ignoredBy(annotatedEvent("BackOff", reasons)))
+	assert.Empty(t, o.ignoredBy(annotatedEvent("Pulled", reasons)))
+	assert.Empty(t, o.ignoredBy(annotatedEvent("", reasons)))
+
+	assert.Nil(t, newAnnotationOverrides(AnnotationOverridesConfig{AllowedReceivers: []string{"team-a"}}))
+}
+
+func TestAnnotationOverrides_Receivers(t *testing.T) {
+	o := newAnnotationOverrides(AnnotationOverridesConfig{Enabled: true, AllowedReceivers: []string{"team-a", "team-b"}})
+
+	ev := annotatedEvent("BackOff", map[string]string{AnnotationReceivers: "team-a, platform,team-b,team-a"})
+	assert.Equal(t, []string{"team-a", "team-b"}, o.receivers(ev))
+	assert.Empty(t, o.receivers(annotatedEvent("BackOff", nil)))
+}
+
+func TestEngine_AnnotationOverrides(t *testing.T) {
+	reg := &testReceiverRegistry{}
+	cfg := &Config{
+		Route: Route{Match: []Rule{{Reason: "BackOff", Receiver: "slack"}}},
+		AnnotationOverrides: AnnotationOverridesConfig{
+			Enabled:          true,
+			AllowedReceivers: []string{"slack", "team-a"},
+		},
+		RouteTraces: 10,
+	}
+	e := NewEngine(cfg, reg)
+
+	backOff := annotatedEvent("BackOff", map[string]string{AnnotationReceivers: "team-a,slack"})
+	e.OnEvent(backOff)
+	pulled := annotatedEvent("Pulled", map[string]string{AnnotationReceivers: "team-a"})
+	e.OnEvent(pulled)
+	e.OnEvent(annotatedEvent("BackOff", map[string]string{AnnotationIgnore: "true", AnnotationReceivers: "team-a"}))
+
+	// The route sent the event to slack already, so only team-a is added
+	assert.Equal(t, 1, reg.count("slack"))
+	assert.Equal(t, 2, reg.count("team-a"))
+	assert.True(t, reg.isEventRcvd("team-a", pulled))
+
+	traces := e.Traces.Traces()
+	require.Len(t, traces, 3)
+	assert.Equal(t, AnnotationIgnore, traces[0].IgnoredBy)
+	assert.Equal(t, []string{"team-a"}, traces[1].Receivers)
+	assert.Equal(t, []string{"slack", "team-a"}, traces[2].Receivers)
+
+	// Disabled by a reload, the annotations are not honored anymore
+	require.NoError(t, e.Reload(&Config{Route: cfg.Route}))
+	e.OnEvent(pulled)
+	assert.Equal(t, 2, reg.count("team-a"))
+}
+
+func TestValidate_AnnotationOverrides(t *testing.T) {
+	receivers := []sinks.ReceiverConfig{{Name: "team-a"}}
+	cfg := AnnotationOverridesConfig{Enabled: true, AllowedReceivers: []string{"team-a"}}
+	require.NoError(t, cfg.validate(receivers))
+
+	cfg.AllowedReceivers = append(cfg.AllowedReceivers, "team-b")
+	assert.Error(t, cfg.validate(receivers))
+}
@@ -0,0 +1,149 @@
+package exporter
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+)
+
+// processor transforms an event in place
+type processor func(ev *kube.EnhancedEvent)
+
+// processorChain applies its processors in order, it is empty when none is configured
+type processorChain []processor
+
+// newProcessorChain compiles the processors of the configs, in the order they are configured
+func newProcessorChain(cfgs []sinks.ProcessorConfig) (processorChain, error) {
+	var chain processorChain
+	for i, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("processors[%d]: %w", i, err)
+		}
+		p, err := compileProcessor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("processors[%d]: %w", i, err)
+		}
+		chain = append(chain, p...)
+	}
+	return chain, nil
+}
+
+// compileProcessor compiles the operation of a validated config, a set, copy or drop of several fields makes a
+// processor per field
+func compileProcessor(cfg sinks.ProcessorConfig) (processorChain, error) {
+	var chain processorChain
+	// The fields of a step are processed in the order of their names, so that the result does not depend on the
+	// order of the map
+	for _, field := range slices.Sorted(maps.Keys(cfg.Set)) {
+		value := cfg.Set[field]
+		set, err := kube.CompileFieldSetter(field)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, func(ev *kube.EnhancedEvent) { set(ev, value) })
+	}
+	for _, field := range slices.Sorted(maps.Keys(cfg.Copy)) {
+		from := cfg.Copy[field]
+		set, err := kube.CompileFieldSetter(field)
+		if err != nil {
+			return nil, err
+		}
+		get, err := kube.CompileField(from)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, func(ev *kube.EnhancedEvent) {
+			if v, ok := get(ev); ok {
+				set(ev, v)
+			}
+		})
+	}
+	for _, field := range cfg.Drop {
+		drop, err := kube.CompileFieldDropper(field)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, processor(drop))
+	}
+	if r := cfg.Redact; r != nil {
+		field := cmp.Or(r.Field, sinks.DefaultProcessorField)
+		get, err := kube.CompileField(field)
+		if err != nil {
+			return nil, err
+		}
+		set, err := kube.CompileFieldSetter(field)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		replacement := cmp.Or(r.Replacement, sinks.DefaultRedactReplacement)
+		chain = append(chain, func(ev *kube.EnhancedEvent) {
+			if v, ok := get(ev); ok && pattern.MatchString(v) {
+				set(ev, pattern.ReplaceAllString(v, replacement))
+			}
+		})
+	}
+	if x := cfg.Extract; x != nil {
+		get, err := kube.CompileField(cmp.Or(x.Field, sinks.DefaultProcessorField))
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(x.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, extractor(get, pattern))
+	}
+	return chain, nil
+}
+
+// extractor sets the named groups of the pattern which took part in its first match as custom fields
+func extractor(get kube.FieldGetter, pattern *regexp.Regexp) processor {
+	names := pattern.SubexpNames()
+	return func(ev *kube.EnhancedEvent) {
+		v, ok := get(ev)
+		if !ok {
+			return
+		}
+		match := pattern.FindStringSubmatchIndex(v)
+		if match == nil {
+			return
+		}
+		var fields map[string]string
+		for i, name := range names {
+			if name == "" || match[2*i] < 0 {
+				continue
+			}
+			if fields == nil {
+				// The fields may be shared with other events, so they are copied before they are modified
+				fields = make(map[string]string, len(ev.Fields)+len(names))
+				maps.Copy(fields, ev.Fields)
+			}
+			fields[name] = v[match[2*i]:match[2*i+1]]
+		}
+		if fields != nil {
+			ev.Fields = fields
+		}
+	}
+}
+
+// process returns the event transformed by the processors. The event is left unchanged, since it may be sent to
+// other receivers as well: the processors transform a copy, which shares the maps the processors did not modify.
+func (c processorChain) process(ev *kube.EnhancedEvent) *kube.EnhancedEvent {
+	if len(c) == 0 {
+		return ev
+	}
+	processed := *ev
+	for _, p := range c {
+		p(&processed)
+	}
+	return &processed
+}
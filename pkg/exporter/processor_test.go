@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustCompileProcessors(t *testing.T, cfgs ...sinks.ProcessorConfig) processorChain {
+	t.Helper()
+	chain, err := newProcessorChain(cfgs)
+	require.NoError(t, err)
+	return chain
+}
+
+func TestProcessorChain(t *testing.T) {
+	chain := mustCompileProcessors(t,
+		sinks.ProcessorConfig{Set: map[string]string{"fields.env": "prod", "fields.region": "eu-west-1"}},
+		sinks.ProcessorConfig{Copy: map[string]string{"fields.team": "involvedObject.labels.team", "fields.app": "involvedObject.labels.app"}},
+		sinks.ProcessorConfig{Redact: &sinks.RedactConfig{Pattern: `(token|password)=[^"\s]+`, Replacement: "$1=***"}},
+		sinks.ProcessorConfig{Extract: &sinks.ExtractConfig{Pattern: `image "(?P<image>[^"]+)"|exit code (?P<exitCode>\d+)`}},
+		sinks.ProcessorConfig{Drop: []string{"involvedObject.annotations"}},
+	)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Message = `Failed to pull image "registry.example.com/api:1.2?token=s3cr3t"`
+	ev.InvolvedObject.Labels = map[string]string{"team": "payments"}
+	ev.InvolvedObject.Annotations = map[string]string{"owner": "jane"}
+
+	processed := chain.process(ev)
+	assert.Equal(t, `Failed to pull image "registry.example.com/api:1.2?token=***"`, processed.Message)
+	assert.Equal(t, map[string]string{
+		"env":    "prod",
+		"region": "eu-west-1",
+		"team":   "payments",
+		"image":  "registry.example.com/api:1.2?token=***",
+	}, processed.Fields)
+	assert.Nil(t, processed.InvolvedObject.Annotations)
+	image, err := sinks.GetString(processed, "{{ .Fields.image }} ({{ .Fields.env }})")
+	require.NoError(t, err)
+	assert.Equal(t, "registry.example.com/api:1.2?token=*** (prod)", image)
+
+	// The event itself is left unchanged for the other receivers
+	assert.Contains(t, ev.Message, "token=s3cr3t")
+	assert.Nil(t, ev.Fields)
+	assert.Equal(t, map[string]string{"owner": "jane"}, ev.InvolvedObject.Annotations)
+
+	var none processorChain
+	assert.Same(t, ev, none.process(ev))
+}
+
+func TestProcessorConfig_Invalid(t *testing.T) {
+	for _, cfg := range []sinks.ProcessorConfig{
+		{},
+		{Set: map[string]string{"fields.env": "prod"}, Drop: []string{"message"}},
+		{Set: map[string]string{"namespace": "default"}},
+		{Copy: map[string]string{"fields.team": "unknown"}},
+		{Drop: []string{"involvedObject.kind"}},
+		{Redact: &sinks.RedactConfig{}},
+		{Redact: &sinks.RedactConfig{Pattern: "("}},
+		{Extract: &sinks.ExtractConfig{Pattern: `exit code (\d+)`}},
+		{Extract: &sinks.ExtractConfig{Field: "unknown", Pattern: `(?P<code>\d+)`}},
+	} {
+		_, err := newProcessorChain([]sinks.ProcessorConfig{cfg})
+		assert.Error(t, err, "processor %+v", cfg)
+	}
+}
+
+func TestEngine_Processors(t *testing.T) {
+	reg := &testReceiverRegistry{}
+	cfg := &Config{
+		Processors: []sinks.ProcessorConfig{
+			{Redact: &sinks.RedactConfig{Pattern: `password=\S+`}},
+			{Extract: &sinks.ExtractConfig{Pattern: `exit code (?P<exitCode>\d+)`}},
+		},
+		Route:       Route{Match: []Rule{{Fields: map[string]string{"exitCode": "^137$"}, Receiver: "oom"}}},
+		RouteTraces: 10,
+	}
+	require.NoError(t, cfg.PreCompilePatterns())
+	e := NewEngine(cfg, reg)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Message = "Container exited with exit code 137, password=hunter2"
+	e.OnEvent(ev)
+	e.OnEvent(eventWithMessage("Container exited with exit code 1"))
+
+	require.Equal(t, 1, reg.count("oom"))
+	assert.Equal(t, "Container exited with exit code 137, [REDACTED]", reg.rcvd["oom"][0].Message)
+	// The traces hold the processed events
+	assert.Equal(t, "Container exited with exit code 137, [REDACTED]", e.Traces.Traces()[1].Event.Message)
+
+	require.NoError(t, e.Reload(&Config{Route: cfg.Route}))
+	e.OnEvent(ev)
+	assert.Equal(t, 1, reg.count("oom"))
+}
+
+func TestChannelBasedReceiverRegistry_ProcessesEvents(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	processed := &recordingSink{}
+	reg.Register("processed", processed, &sinks.ReceiverConfig{Name: "processed", Processors: []sinks.ProcessorConfig{
+		{Set: map[string]string{"fields.env": "prod"}},
+		{Drop: []string{"message"}},
+	}})
+	raw := &recordingSink{}
+	reg.Register("raw", raw, &sinks.ReceiverConfig{Name: "raw"})
+
+	ev := eventWithMessage("BackOff")
+	reg.SendEvent("processed", ev)
+	reg.SendEvent("raw", ev)
+	reg.Close(context.Background())
+
+	require.Len(t, processed.receivedEvents(), 1)
+	assert.Empty(t, processed.receivedEvents()[0].Message)
+	assert.Equal(t, map[string]string{"env": "prod"}, processed.receivedEvents()[0].Fields)
+	assert.Equal(t, []string{"BackOff"}, raw.received())
+	assert.Nil(t, raw.receivedEvents()[0].Fields)
+}
+
+func TestReadConfig_Processors(t *testing.T) {
+	const yml = `
+processors:
+  - set:
+      fields.env: prod
+  - redact:
+      pattern: "token=\\S+"
+receivers:
+  - name: slack
+    processors:
+      - extract:
+          pattern: "exit code (?P<exitCode>\\d+)"
+      - drop: [involvedObject.annotations]
+`
+	cfg := readConfig(t, yml)
+	cfg.SetDefaults()
+	require.NoError(t, cfg.Validate())
+	require.Len(t, cfg.Processors, 2)
+	assert.Equal(t, "message", cfg.Processors[1].Redact.Field)
+	assert.Equal(t, sinks.DefaultRedactReplacement, cfg.Processors[1].Redact.Replacement)
+	require.Len(t, cfg.Receivers[0].Processors, 2)
+	assert.Equal(t, `exit code (?P<exitCode>\d+)`, cfg.Receivers[0].Processors[0].Extract.Pattern)
+
+	cfg.Receivers[0].Processors[1].Drop = []string{"reason", "namespace"}
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,196 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var errQueueClosed = errors.New("receiver queue is closed")
+
+// eventQueue is a bounded FIFO of the events waiting for a receiver. When it is full, the overflow policy decides
+// whether the producer waits for room or which event is dropped.
+type eventQueue struct {
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	overflow string
+	items    []queuedEvent
+	size     int
+	mu       sync.Mutex
+	closed   bool
+}
+
+func newEventQueue(cfg sinks.QueueConfig) *eventQueue {
+	cfg.SetDefaults()
+	q := &eventQueue{
+		overflow: cfg.Overflow,
+		size:     cfg.Size,
+		items:    make([]queuedEvent, 0, cfg.Size),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// newShardedQueues splits the queue configuration into one queue per worker, so the bound applies to all of them
+// together
+func newShardedQueues(cfg sinks.QueueConfig, workers int) []*eventQueue {
+	cfg.SetDefaults()
+	workers = max(workers, 1)
+	cfg.Size = max(cfg.Size/workers, 1)
+	queues := make([]*eventQueue, workers)
+	for i := range queues {
+		queues[i] = newEventQueue(cfg)
+	}
+	return queues
+}
+
+// push appends the event to the queue. If an event had to be dropped to respect the bound, it is returned
+// together with true. The dropped event is either the pushed one or an event which was already queued.
+// Pushing to a closed queue fails with errQueueClosed.
+func (q *eventQueue) push(item queuedEvent) (queuedEvent, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) >= q.size && q.overflow == sinks.OverflowBlock && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return queuedEvent{}, false, errQueueClosed
+	}
+
+	var dropped queuedEvent
+	var ok bool
+	if len(q.items) >= q.size {
+		switch q.overflow {
+		case sinks.OverflowDropOldest:
+			dropped, ok = q.removeAt(0), true
+		case sinks.OverflowDropNormal:
+			// Warnings are more valuable, so they make room by evicting the oldest Normal event
+			idx := q.oldestNormal()
+			if item.event.Type != corev1.EventTypeWarning || idx < 0 {
+				return item, true, nil
+			}
+			dropped, ok = q.removeAt(idx), true
+		default:
+			return item, true, nil
+		}
+	}
+
+	q.items = append(q.items, item)
+	q.notEmpty.Signal()
+	return dropped, ok, nil
+}
+
+// restore appends an event regardless of the bound of the queue, it is used for the events replayed from a spool
+// before the workers start. The producers wait or drop events until the queue is back below its bound.
+func (q *eventQueue) restore(item queuedEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, item)
+	q.notEmpty.Signal()
+}
+
+// pop blocks until an event is available. It returns false once the queue is closed and drained.
+func (q *eventQueue) pop() (queuedEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return queuedEvent{}, false
+	}
+
+	item := q.removeAt(0)
+	q.notFull.Signal()
+	return item, true
+}
+
+// popBatch blocks until an event is available, and then waits up to maxLatency for more events until it holds n
+// of them. It returns nil once the queue is closed and drained. Closing the queue sends the batch right away.
+func (q *eventQueue) popBatch(n int, maxLatency time.Duration) []queuedEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// A batch larger than the queue could never fill up while the producers wait for room
+	n = max(min(n, q.size), 1)
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil
+	}
+	if len(q.items) < n && !q.closed && maxLatency > 0 {
+		expired := false
+		timer := time.AfterFunc(maxLatency, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			expired = true
+			q.notEmpty.Broadcast()
+		})
+		for len(q.items) < n && !q.closed && !expired {
+			q.notEmpty.Wait()
+		}
+		timer.Stop()
+	}
+
+	batch := make([]queuedEvent, min(n, len(q.items)))
+	for i := range batch {
+		batch[i] = q.removeAt(0)
+	}
+	q.notFull.Broadcast()
+	return batch
+}
+
+func (q *eventQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// close rejects further events and wakes up all the waiting producers and consumers. The events still in the
+// queue can be popped until it is drained.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// abort closes the queue and discards the events which are still in it, which are returned
+func (q *eventQueue) abort() []queuedEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	discarded := q.items
+	q.items = nil
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	return discarded
+}
+
+func (q *eventQueue) oldestNormal() int {
+	for i := range q.items {
+		if q.items[i].event.Type != corev1.EventTypeWarning {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *eventQueue) removeAt(i int) queuedEvent {
+	item := q.items[i]
+	if i == 0 {
+		q.items[0] = queuedEvent{}
+		q.items = q.items[1:]
+	} else {
+		q.items = append(q.items[:i], q.items[i+1:]...)
+	}
+	return item
+}
@@ -0,0 +1,187 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func queuedEventOf(msg, eventType string) queuedEvent {
+	ev := kube.EnhancedEvent{}
+	ev.Message = msg
+	ev.Type = eventType
+	return queuedEvent{event: ev}
+}
+
+func drain(q *eventQueue) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msgs := make([]string, 0, len(q.items))
+	for _, item := range q.items {
+		msgs = append(msgs, item.event.Message)
+	}
+	return msgs
+}
+
+func TestEventQueue_DropNewest(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 2, Overflow: sinks.OverflowDropNewest})
+
+	_, dropped, _ := q.push(queuedEventOf("1", corev1.EventTypeNormal))
+	assert.False(t, dropped)
+	q.push(queuedEventOf("2", corev1.EventTypeNormal))
+
+	item, dropped, _ := q.push(queuedEventOf("3", corev1.EventTypeNormal))
+	assert.True(t, dropped)
+	assert.Equal(t, "3", item.event.Message)
+	assert.Equal(t, []string{"1", "2"}, drain(q))
+}
+
+func TestEventQueue_DropOldest(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 2, Overflow: sinks.OverflowDropOldest})
+
+	q.push(queuedEventOf("1", corev1.EventTypeNormal))
+	q.push(queuedEventOf("2", corev1.EventTypeNormal))
+
+	item, dropped, _ := q.push(queuedEventOf("3", corev1.EventTypeNormal))
+	assert.True(t, dropped)
+	assert.Equal(t, "1", item.event.Message)
+	assert.Equal(t, []string{"2", "3"}, drain(q))
+}
+
+func TestEventQueue_DropNormal(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 3, Overflow: sinks.OverflowDropNormal})
+
+	q.push(queuedEventOf("w1", corev1.EventTypeWarning))
+	q.push(queuedEventOf("n1", corev1.EventTypeNormal))
+	q.push(queuedEventOf("n2", corev1.EventTypeNormal))
+
+	// A Normal event is never queued in place of another one
+	item, dropped, _ := q.push(queuedEventOf("n3", corev1.EventTypeNormal))
+	assert.True(t, dropped)
+	assert.Equal(t, "n3", item.event.Message)
+
+	// A Warning evicts the oldest Normal event
+	item, dropped, _ = q.push(queuedEventOf("w2", corev1.EventTypeWarning))
+	assert.True(t, dropped)
+	assert.Equal(t, "n1", item.event.Message)
+	assert.Equal(t, []string{"w1", "n2", "w2"}, drain(q))
+
+	q.push(queuedEventOf("w3", corev1.EventTypeWarning))
+	item, dropped, _ = q.push(queuedEventOf("w4", corev1.EventTypeWarning))
+	assert.True(t, dropped)
+	assert.Equal(t, "w4", item.event.Message)
+	assert.Equal(t, []string{"w1", "w2", "w3"}, drain(q))
+}
+
+func TestEventQueue_BlockWaitsForRoom(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 1, Overflow: sinks.OverflowBlock})
+	q.push(queuedEventOf("1", corev1.EventTypeNormal))
+
+	pushed := make(chan bool)
+	go func() {
+		_, dropped, _ := q.push(queuedEventOf("2", corev1.EventTypeNormal))
+		pushed <- dropped
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	item, ok := q.pop()
+	require.True(t, ok)
+	assert.Equal(t, "1", item.event.Message)
+	assert.False(t, <-pushed)
+	assert.Equal(t, []string{"2"}, drain(q))
+}
+
+func TestEventQueue_CloseUnblocks(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 1})
+
+	popped := make(chan bool)
+	go func() {
+		_, ok := q.pop()
+		popped <- ok
+	}()
+
+	q.close()
+	assert.False(t, <-popped)
+
+	_, _, err := q.push(queuedEventOf("1", corev1.EventTypeNormal))
+	assert.ErrorIs(t, err, errQueueClosed)
+}
+
+func TestEventQueue_CloseDrainsQueuedEvents(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 3})
+	for _, msg := range []string{"1", "2"} {
+		_, _, err := q.push(queuedEventOf(msg, corev1.EventTypeNormal))
+		require.NoError(t, err)
+	}
+
+	q.close()
+	for _, msg := range []string{"1", "2"} {
+		item, ok := q.pop()
+		require.True(t, ok)
+		assert.Equal(t, msg, item.event.Message)
+	}
+	_, ok := q.pop()
+	assert.False(t, ok)
+}
+
+func TestEventQueue_AbortDiscardsQueuedEvents(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 3})
+	for _, msg := range []string{"1", "2"} {
+		_, _, err := q.push(queuedEventOf(msg, corev1.EventTypeNormal))
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, q.abort(), 2)
+	_, ok := q.pop()
+	assert.False(t, ok)
+}
+
+func TestNewShardedQueues(t *testing.T) {
+	queues := newShardedQueues(sinks.QueueConfig{Size: 10, Overflow: sinks.OverflowDropNewest}, 4)
+	require.Len(t, queues, 4)
+	for _, q := range queues {
+		assert.Equal(t, 2, q.size)
+		assert.Equal(t, sinks.OverflowDropNewest, q.overflow)
+	}
+
+	queues = newShardedQueues(sinks.QueueConfig{Size: 2}, 4)
+	assert.Equal(t, 1, queues[0].size)
+	assert.Len(t, newShardedQueues(sinks.QueueConfig{}, 0), 1)
+}
+
+func TestEventQueue_PopBatch(t *testing.T) {
+	q := newEventQueue(sinks.QueueConfig{Size: 10})
+	for _, msg := range []string{"1", "2", "3"} {
+		_, _, err := q.push(queuedEventOf(msg, corev1.EventTypeNormal))
+		require.NoError(t, err)
+	}
+
+	// A full batch is returned right away
+	batch := q.popBatch(2, time.Hour)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "2", batch[1].event.Message)
+
+	// A partial batch is returned once the max latency passed
+	start := time.Now()
+	batch = q.popBatch(2, 20*time.Millisecond)
+	require.Len(t, batch, 1)
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// Closing sends the partial batch, and a drained closed queue returns nil
+	_, _, err := q.push(queuedEventOf("4", corev1.EventTypeNormal))
+	require.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, q.close)
+	batch = q.popBatch(2, time.Hour)
+	require.Len(t, batch, 1)
+	assert.Nil(t, q.popBatch(2, time.Hour))
+}
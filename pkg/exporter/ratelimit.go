@@ -0,0 +1,77 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"golang.org/x/time/rate"
+)
+
+// defaultRateLimitedPause is how long sending is held back after a rate-limited error without a retry-after
+const defaultRateLimitedPause = time.Second
+
+// rateLimiter paces the sends to a receiver with a token bucket. Independently of the bucket, a rate-limited error
+// returned by the sink pauses all sends until the delay requested by the remote side passed.
+type rateLimiter struct {
+	pausedUntil time.Time
+	limiter     *rate.Limiter
+	mu          sync.Mutex
+}
+
+// newRateLimiter returns a limiter which only honors the pauses when cfg is nil
+func newRateLimiter(cfg *sinks.RateLimitConfig) *rateLimiter {
+	if cfg == nil {
+		return &rateLimiter{limiter: rate.NewLimiter(rate.Inf, 0)}
+	}
+	c := *cfg
+	c.SetDefaults()
+	return &rateLimiter{limiter: rate.NewLimiter(rate.Limit(c.EventsPerSecond), c.Burst)}
+}
+
+// wait blocks until the next event can be sent. It returns the context error if ctx is done first.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	return l.waitN(ctx, 1)
+}
+
+// waitN blocks until n events can be sent. The tokens of a batch larger than the burst are taken in several steps.
+func (l *rateLimiter) waitN(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		delay := time.Until(l.pausedUntil)
+		l.mu.Unlock()
+		if delay <= 0 {
+			break
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	for n > 0 {
+		k := n
+		if burst := l.limiter.Burst(); burst > 0 {
+			k = min(k, burst)
+		}
+		res := l.limiter.ReserveN(time.Now(), k)
+		if err := sleep(ctx, res.Delay()); err != nil {
+			res.Cancel()
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// pause holds back all sends for d, or for a default delay when d is zero
+func (l *rateLimiter) pause(d time.Duration) {
+	if d <= 0 {
+		d = defaultRateLimitedPause
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_PacesAfterBurst(t *testing.T) {
+	l := newRateLimiter(&sinks.RateLimitConfig{EventsPerSecond: 50, Burst: 2})
+
+	start := time.Now()
+	for range 4 {
+		require.NoError(t, l.wait(context.Background()))
+	}
+	// The burst passes right away, the two following events wait 20ms each
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
+
+func TestRateLimiter_Pause(t *testing.T) {
+	l := newRateLimiter(nil)
+
+	l.pause(30 * time.Millisecond)
+	start := time.Now()
+	require.NoError(t, l.wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+
+	l.pause(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.wait(ctx), context.Canceled)
+}
+
+func TestDeliver_RateLimitedErrorPausesReceiver(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &flakySink{errs: []error{sinks.RateLimited(errors.New("429"), 40*time.Millisecond)}}
+	rcv := newRetryReceiver(sink, &sinks.RetryConfig{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	start := time.Now()
+	attempts, err := reg.deliver(rcv, eventWithMessage("throttled"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+	// The pause is shared by all the workers of the receiver
+	assert.GreaterOrEqual(t, rcv.limiter.pausedUntil.Sub(start), 40*time.Millisecond)
+}
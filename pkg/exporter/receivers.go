@@ -1,6 +1,8 @@
 package exporter
 
 import (
+	"context"
+
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
 )
@@ -8,6 +10,11 @@ import (
 // ReceiverRegistry registers a receiver with the appropriate sink
 type ReceiverRegistry interface {
 	SendEvent(string, *kube.EnhancedEvent)
-	Register(string, sinks.Sink)
-	Close()
+	// Register adds a receiver, or replaces the receiver registered under the same name. When it fails, the registered
+	// receivers are left unchanged and the sink is left to the caller.
+	Register(string, sinks.Sink, *sinks.ReceiverConfig) error
+	// Unregister removes a receiver, which delivers its pending events and is closed in the background
+	Unregister(string)
+	// Close stops accepting events and delivers the pending ones until ctx is done
+	Close(ctx context.Context)
 }
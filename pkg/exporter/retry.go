@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/rs/zerolog/log"
+)
+
+// backoff returns the delay before the next attempt after the given number of failed attempts. The base backoff
+// is doubled for every failure up to the max backoff, and then shortened by a random fraction of up to jitter.
+func backoff(cfg *sinks.RetryConfig, failures int) time.Duration {
+	d := cfg.BaseBackoff
+	for i := 1; i < failures && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if cfg.MaxBackoff > 0 {
+		d = min(d, cfg.MaxBackoff)
+	}
+	if cfg.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * cfg.Jitter * float64(d))
+	}
+	return d
+}
+
+// deliver sends the event to the sink of the receiver, and attempts again after retryable errors as long as the
+// retry configuration allows it. It returns the number of attempts and the error of the last one.
+func (r *ChannelBasedReceiverRegistry) deliver(rcv *receiver, ev *kube.EnhancedEvent) (int, error) {
+	ctx := rcv.ctx
+	maxAttempts := 1
+	if rcv.retry != nil {
+		maxAttempts = max(rcv.retry.MaxAttempts, 1)
+		if rcv.retry.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, rcv.retry.Deadline)
+			defer cancel()
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := r.attempt(ctx, rcv, ev)
+		if err == nil || attempt >= maxAttempts || sinks.IsPermanent(err) {
+			return attempt, err
+		}
+
+		wait := max(backoff(rcv.retry, attempt), sinks.RetryAfter(err))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return attempt, err
+		}
+
+		log.Debug().Err(err).Str("sink", rcv.name).Int("attempt", attempt).Dur("backoff", wait).Msg("Cannot send event, retrying")
+		if sleep(ctx, wait) != nil {
+			return attempt, err
+		}
+		r.MetricsStore.SendRetries.WithLabelValues(rcv.name).Inc()
+	}
+}
+
+// attempt sends the event to the sink once the rate limit allows it, unless the circuit breaker of the receiver is
+// open. The send is bounded by the receiver timeout.
+func (r *ChannelBasedReceiverRegistry) attempt(ctx context.Context, rcv *receiver, ev *kube.EnhancedEvent) error {
+	if err := rcv.limiter.wait(ctx); err != nil {
+		return err
+	}
+	if rcv.breaker != nil {
+		if ok, wait := rcv.breaker.allow(); !ok {
+			return sinks.Retryable(errCircuitOpen, wait)
+		}
+	}
+
+	if rcv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rcv.timeout)
+		defer cancel()
+	}
+	err := rcv.sink.Send(ctx, ev)
+	if rcv.breaker != nil {
+		rcv.breaker.record(err)
+	}
+	if sinks.IsRateLimited(err) {
+		r.MetricsStore.SendRateLimited.WithLabelValues(rcv.name).Inc()
+		rcv.limiter.pause(sinks.RetryAfter(err))
+	}
+	return err
+}
+
+// sleep waits for d, and fails early when ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
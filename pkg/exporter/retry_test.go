@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakySink returns the given errors in order, and succeeds once they are exhausted
+type flakySink struct {
+	errs     []error
+	attempts int
+	mu       sync.Mutex
+}
+
+func (s *flakySink) Send(_ context.Context, _ *kube.EnhancedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *flakySink) Close() {}
+
+func newRetryReceiver(sink sinks.Sink, cfg *sinks.RetryConfig) *receiver {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &receiver{name: "retry", sink: sink, retry: cfg, limiter: newRateLimiter(nil), ctx: ctx, cancel: cancel}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := &sinks.RetryConfig{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, backoff(cfg, 1))
+	assert.Equal(t, 200*time.Millisecond, backoff(cfg, 2))
+	assert.Equal(t, 400*time.Millisecond, backoff(cfg, 3))
+	assert.Equal(t, time.Second, backoff(cfg, 5))
+	assert.Equal(t, time.Second, backoff(cfg, 50))
+
+	cfg.Jitter = 0.5
+	for range 100 {
+		d := backoff(cfg, 1)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+}
+
+func TestDeliver_RetriesRetryableErrors(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &flakySink{errs: []error{errors.New("timeout"), sinks.Retryable(errors.New("429"), 0)}}
+	rcv := newRetryReceiver(sink, &sinks.RetryConfig{MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	attempts, err := reg.deliver(rcv, eventWithMessage("retried"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDeliver_StopsOnPermanentError(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &flakySink{errs: []error{sinks.Permanent(errors.New("400"))}}
+	rcv := newRetryReceiver(sink, &sinks.RetryConfig{MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	attempts, err := reg.deliver(rcv, eventWithMessage("rejected"))
+
+	assert.True(t, sinks.IsPermanent(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDeliver_GivesUpAfterMaxAttempts(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	unavailable := errors.New("unavailable")
+	sink := &flakySink{errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	rcv := newRetryReceiver(sink, &sinks.RetryConfig{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	attempts, err := reg.deliver(rcv, eventWithMessage("failed"))
+
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDeliver_HonorsDeadline(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &flakySink{errs: []error{sinks.Retryable(errors.New("429"), time.Minute)}}
+	rcv := newRetryReceiver(sink, &sinks.RetryConfig{MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Deadline: time.Second})
+
+	start := time.Now()
+	attempts, err := reg.deliver(rcv, eventWithMessage("late"))
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDeliver_WithoutRetryConfigAttemptsOnce(t *testing.T) {
+	reg := &ChannelBasedReceiverRegistry{MetricsStore: newTestMetricsStore(t)}
+	sink := &flakySink{errs: []error{errors.New("unavailable")}}
+
+	attempts, err := reg.deliver(newRetryReceiver(sink, nil), eventWithMessage("once"))
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
@@ -1,6 +1,13 @@
 package exporter
 
-import "github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+)
 
 // Route allows using rules to drop events or match events to specific receivers.
 // It also allows using routes recursively for complex route building to fit
@@ -9,35 +16,113 @@ type Route struct {
 	Drop   []Rule
 	Match  []Rule
 	Routes []Route
+	// Continue tells whether the sibling routes after this one still process an event this route matched. It
+	// defaults to true, false makes the first matching route win.
+	Continue *bool
+	// Dedup suppresses the repeats of the events which are not dropped by the route, it takes effect once the
+	// route is compiled by Config.Validate
+	Dedup *sinks.DedupConfig
+	dedup *deduplicator
+}
+
+// ProcessEvent sends the event to the receivers of the matching rules and sub-routes. It returns whether the route
+// matched the event: the event is not dropped and all the match rules are satisfied.
+func (r *Route) ProcessEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry) bool {
+	return r.processEvent(ev, registry, nil, "")
 }
 
-func (r *Route) ProcessEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry) {
+// processEvent is ProcessEvent recording the decisions of the route, named by its path, and its sub-routes in the
+// trace, if any
+func (r *Route) processEvent(ev *kube.EnhancedEvent, registry ReceiverRegistry, trace *RouteTrace, path string) bool {
 	// First determine whether we will drop the event: If any of the drop is matched, we break the loop
 	for i := range r.Drop {
 		v := &r.Drop[i]
 		if v.MatchesEvent(ev) {
-			return
+			if trace != nil {
+				trace.add(RouteStep{Route: path, Rule: fmt.Sprintf("drop[%d]", i), Result: StepDropped})
+			}
+			return false
 		}
 	}
 
 	// It has match rules, it should go to the matchers
 	matchesAll := true
+	var matched []int
 	for i := range r.Match {
 		rule := &r.Match[i]
-		if rule.MatchesEvent(ev) {
-			if rule.Receiver != "" {
-				registry.SendEvent(rule.Receiver, ev)
-				// Send the event down the hole
-			}
+		var ok bool
+		if trace == nil {
+			ok = rule.MatchesEvent(ev)
+		} else if failed := rule.failedFields(ev, true); len(failed) > 0 {
+			trace.add(RouteStep{Route: path, Rule: fmt.Sprintf("match[%d]", i), Result: StepNotMatched, Failed: failed})
+		} else {
+			ok = true
+		}
+		if ok {
+			matched = append(matched, i)
 		} else {
 			matchesAll = false
 		}
 	}
 
+	// Only the events the route handles are deduplicated, others must not mark their key as seen. A suppressed repeat
+	// still counts as matched, so that it does not reach the sibling routes either.
+	if r.dedup != nil && (len(matched) > 0 || matchesAll) {
+		if ev = r.dedup.check(ev); ev == nil {
+			if trace != nil {
+				trace.add(RouteStep{Route: path, Result: StepSuppressed})
+			}
+			return matchesAll
+		}
+	}
+
+	// Send the event down the hole
+	for _, i := range matched {
+		receivers := r.Match[i].receivers(ev)
+		for _, receiver := range receivers {
+			registry.SendEvent(receiver, ev)
+		}
+		if trace != nil {
+			trace.add(RouteStep{Route: path, Rule: fmt.Sprintf("match[%d]", i), Result: StepMatched, Receivers: receivers})
+		}
+	}
+
 	// If all matches are satisfied, we can send them down to the rabbit hole
 	if matchesAll {
-		for _, subRoute := range r.Routes {
-			subRoute.ProcessEvent(ev, registry)
+		for i := range r.Routes {
+			subRoute := &r.Routes[i]
+			var subPath string
+			if trace != nil {
+				subPath = fmt.Sprintf("%s.routes[%d]", path, i)
+			}
+			if subRoute.processEvent(ev, registry, trace, subPath) && subRoute.Continue != nil && !*subRoute.Continue {
+				if trace != nil {
+					trace.add(RouteStep{Route: subPath, Result: StepStopped})
+				}
+				break
+			}
 		}
 	}
+	return matchesAll
+}
+
+// keepDedup takes over the deduplicators of the previous route and its sub-routes at the same paths whose config
+// did not change, so that a reload does not send again the repeats they suppress
+func (r *Route) keepDedup(previous *Route) {
+	if r.dedup != nil && previous.dedup != nil && reflect.DeepEqual(r.dedup.cfg, previous.dedup.cfg) {
+		r.dedup = previous.dedup
+	}
+	for i := range min(len(r.Routes), len(previous.Routes)) {
+		r.Routes[i].keepDedup(&previous.Routes[i])
+	}
+}
+
+// setMetricsStore makes the deduplicators of the route and its sub-routes count in the store
+func (r *Route) setMetricsStore(store *metrics.Store) {
+	if r.dedup != nil {
+		r.dedup.setMetricsStore(store)
+	}
+	for i := range r.Routes {
+		r.Routes[i].setMetricsStore(store)
+	}
 }
@@ -1,15 +1,15 @@
 package exporter
 
 import (
-	"bytes"
+	"context"
 	"slices"
 
 	"testing"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
-	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // testReceiverRegistry just records the events to the registry so that tests can validate routing behavior
@@ -17,7 +17,7 @@ type testReceiverRegistry struct {
 	rcvd map[string][]*kube.EnhancedEvent
 }
 
-func (t *testReceiverRegistry) Register(string, sinks.Sink) {
+func (t *testReceiverRegistry) Register(string, sinks.Sink, *sinks.ReceiverConfig) error {
 	panic("Why do you call this? It's for counting imaginary events for tests only")
 }
 
@@ -33,7 +33,11 @@ func (t *testReceiverRegistry) SendEvent(name string, event *kube.EnhancedEvent)
 	t.rcvd[name] = append(t.rcvd[name], event)
 }
 
-func (t *testReceiverRegistry) Close() {
+func (t *testReceiverRegistry) Unregister(string) {
+	panic("Why do you call this? It's for counting imaginary events for tests only")
+}
+
+func (t *testReceiverRegistry) Close(_ context.Context) {
 	// No-op
 }
 
@@ -224,6 +228,49 @@ func Test_GHIssue51(t *testing.T) {
 	assert.False(t, reg.isEventRcvd("elastic", &ev2))
 }
 
+func TestRouteContinue(t *testing.T) {
+	ev := kube.EnhancedEvent{}
+	ev.Namespace = "kube-system"
+	ev.Type = "Warning"
+	stop := false
+
+	r := Route{
+		Routes: []Route{
+			// Dropped, so the next routes still get the event
+			{Drop: []Rule{{Type: "Warning"}}, Match: []Rule{{Receiver: "dropped"}}, Continue: &stop},
+			// Not matched
+			{Match: []Rule{{Namespace: "default", Receiver: "default"}}, Continue: &stop},
+			// Matched, continues by default
+			{Match: []Rule{{Type: "Warning", Receiver: "warnings"}}},
+			// Matched, the first match wins
+			{Match: []Rule{{Namespace: "kube-system", Receiver: "system"}}, Continue: &stop},
+			{Match: []Rule{{Receiver: "all"}}},
+		},
+	}
+
+	reg := testReceiverRegistry{}
+	assert.True(t, r.ProcessEvent(&ev, &reg))
+	assert.Equal(t, 0, reg.count("dropped"))
+	assert.Equal(t, 0, reg.count("default"))
+	assert.Equal(t, 1, reg.count("warnings"))
+	assert.Equal(t, 1, reg.count("system"))
+	assert.Equal(t, 0, reg.count("all"))
+}
+
+func TestRuleReceivers(t *testing.T) {
+	ev := kube.EnhancedEvent{}
+	ev.Type = "Warning"
+	reg := testReceiverRegistry{}
+
+	r := Route{
+		Match: []Rule{{Type: "Warning", Receiver: "slack", Receivers: []string{"opsgenie", "elastic"}}},
+	}
+	r.ProcessEvent(&ev, &reg)
+	assert.True(t, reg.isEventRcvd("slack", &ev))
+	assert.True(t, reg.isEventRcvd("opsgenie", &ev))
+	assert.True(t, reg.isEventRcvd("elastic", &ev))
+}
+
 // mustCompileRule is a helper to compile rule patterns for tests
 func mustCompileRule(t testing.TB, rule Rule) Rule {
 	cfg := Config{Route: Route{Match: []Rule{rule}}}
@@ -247,13 +294,12 @@ func TestBasicRoutePattern(t *testing.T) {
 
 	// check that precompiled patterns work as expected
 	assert.NotNil(t, r.Match[0].namespacePattern)
-	assert.NotNil(t, r.Match[0].receiverPattern)
+	assert.Nil(t, r.Match[0].receiverNames)
 
 	r.ProcessEvent(&ev, &reg)
 	assert.True(t, reg.isEventRcvd("osman", &ev))
 
-	output := &bytes.Buffer{}
-	log.Logger = log.Logger.Output(output)
+	output := captureLogs(t)
 	assert.NotContains(t, output.String(), "falling back to runtime compilation")
 
 }
@@ -283,3 +329,33 @@ func BenchmarkMatchesEvent_WithoutPrecompile(b *testing.B) {
 		rule.MatchesEvent(&ev)
 	}
 }
+
+func TestReceiverModes(t *testing.T) {
+	cfg := Config{
+		Route: Route{
+			Match: []Rule{
+				{Type: "Warning", Receiver: "^slack-", ReceiverMode: ReceiverModeRegex},
+				{Receiver: "team-{{ .Namespace }}", ReceiverMode: ReceiverModeTemplate, DefaultReceiver: "dump"},
+			},
+		},
+		Receivers: []sinks.ReceiverConfig{{Name: "slack-ops"}, {Name: "slack-dev"}, {Name: "team-payments"}, {Name: "dump"}},
+	}
+	require.NoError(t, cfg.PreCompilePatterns())
+
+	ev := kube.EnhancedEvent{}
+	ev.Type = "Warning"
+	ev.Namespace = "payments"
+	reg := testReceiverRegistry{}
+	cfg.Route.ProcessEvent(&ev, &reg)
+	assert.True(t, reg.isEventRcvd("slack-ops", &ev))
+	assert.True(t, reg.isEventRcvd("slack-dev", &ev))
+	assert.True(t, reg.isEventRcvd("team-payments", &ev))
+	assert.Equal(t, 0, reg.count("dump"))
+
+	// An unknown rendered receiver falls back to the default one
+	other := kube.EnhancedEvent{}
+	other.Namespace = "billing"
+	cfg.Route.ProcessEvent(&other, &reg)
+	assert.True(t, reg.isEventRcvd("dump", &other))
+	assert.Equal(t, 0, reg.count("team-billing"))
+}
@@ -1,9 +1,16 @@
 package exporter
 
 import (
+	"fmt"
 	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/google/cel-go/cel"
 	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 )
@@ -18,10 +25,23 @@ func matchString(pattern, s string) bool {
 	return matched
 }
 
+// Modes of the receiver of a rule
+const (
+	ReceiverModeName     = "name"
+	ReceiverModeRegex    = "regex"
+	ReceiverModeTemplate = "template"
+)
+
 // Rule is for matching an event
 type Rule struct {
 	Labels      map[string]string
 	Annotations map[string]string
+	// NamespaceLabels and NamespaceAnnotations match those of the namespace of the event, which requires the
+	// namespace metadata
+	NamespaceLabels      map[string]string `yaml:"namespaceLabels"`
+	NamespaceAnnotations map[string]string `yaml:"namespaceAnnotations"`
+	// Fields match the custom fields the processors set
+	Fields map[string]string
 
 	// Precompiled patterns. Populated when the rule is created.
 	labelsPatterns      map[string]*regexp.Regexp
@@ -33,8 +53,28 @@ type Rule struct {
 	typePattern         *regexp.Regexp
 	componentPattern    *regexp.Regexp
 	hostPattern         *regexp.Regexp
+	ownerKindPattern    *regexp.Regexp
+	ownerNamePattern    *regexp.Regexp
+	namePattern         *regexp.Regexp
+	fieldPathPattern    *regexp.Regexp
+	controllerPattern   *regexp.Regexp
+	instancePattern     *regexp.Regexp
+	actionPattern       *regexp.Regexp
+	relatedKindPattern  *regexp.Regexp
+	relatedNamePattern  *regexp.Regexp
 	messagePattern      *regexp.Regexp
-	receiverPattern     *regexp.Regexp
+	receiverTemplate    *template.Template
+	// receiverNames holds the receivers the pattern of a regex receiver matches
+	receiverNames []string
+	// knownReceivers holds the receivers a template receiver can render
+	knownReceivers map[string]struct{}
+	expressions    []*expressionMatcher
+	program        cel.Program
+	// namespaceLabelsPatterns and namespaceAnnotationsPatterns match the metadata of the namespace
+	namespaceLabelsPatterns      map[string]*regexp.Regexp
+	namespaceAnnotationsPatterns map[string]*regexp.Regexp
+	// fieldsPatterns match the custom fields
+	fieldsPatterns map[string]*regexp.Regexp
 
 	// Fields to match against
 	Message    string
@@ -45,35 +85,157 @@ type Rule struct {
 	Type       string
 	Component  string
 	Host       string
-	Receiver   string
-	MinCount   int32 `yaml:"minCount"`
+	// OwnerKind and OwnerName match the owner of the involved object: its top owner when owners are resolved,
+	// otherwise its controller
+	OwnerKind string `yaml:"ownerKind"`
+	OwnerName string `yaml:"ownerName"`
+	// Name and FieldPath match the name of the involved object and the part of it, e.g. a container
+	Name                string
+	FieldPath           string `yaml:"fieldPath"`
+	ReportingController string `yaml:"reportingController"`
+	ReportingInstance   string `yaml:"reportingInstance"`
+	Action              string
+	// RelatedKind and RelatedName match the related object, which events about a Pod scheduled on a Node refer to
+	// for example
+	RelatedKind string `yaml:"relatedKind"`
+	RelatedName string `yaml:"relatedName"`
+	Receiver    string
+	// ReceiverMode tells how Receiver names the receivers of the rule: as is by default, as a regular expression
+	// matching the names of the receivers with "regex", or as a template rendered with the event with "template"
+	ReceiverMode string `yaml:"receiverMode"`
+	// DefaultReceiver gets the events for which the Receiver template renders an unknown receiver name
+	DefaultReceiver string `yaml:"defaultReceiver"`
+	// Receivers get the matching events as well as Receiver
+	Receivers []string
+	MinCount  int32 `yaml:"minCount"`
+	// MaxCount is the highest count of the matching events, zero means no limit
+	MaxCount int32 `yaml:"maxCount"`
+	// MinAge and MaxAge bound the time since the event was last observed, zero means no bound
+	MinAge time.Duration `yaml:"minAge"`
+	MaxAge time.Duration `yaml:"maxAge"`
+
+	// MatchExpressions must all match as well, they negate and compare fields in ways a regular expression cannot
+	MatchExpressions []MatchExpression `yaml:"matchExpressions"`
+
+	// Expression is a CEL program which must evaluate to true, against the variable event
+	Expression string
+}
+
+// receivers returns the names of all the receivers of the rule for the event
+func (r *Rule) receivers(ev *kube.EnhancedEvent) []string {
+	var names []string
+	switch r.ReceiverMode {
+	case ReceiverModeRegex:
+		names = r.receiverNames
+	case ReceiverModeTemplate:
+		if name := r.renderReceiver(ev); name != "" {
+			names = []string{name}
+		}
+	default:
+		if r.Receiver != "" {
+			names = []string{r.Receiver}
+		}
+	}
+	return slices.Concat(names, r.Receivers)
+}
+
+// renderReceiver renders the receiver template with the event, it returns the default receiver when the template
+// fails or renders an unknown receiver name
+func (r *Rule) renderReceiver(ev *kube.EnhancedEvent) string {
+	if r.receiverTemplate == nil {
+		return r.DefaultReceiver
+	}
+	var buf strings.Builder
+	if err := r.receiverTemplate.Execute(&buf, ev); err != nil {
+		log.Warn().Err(err).Str("receiver", r.Receiver).Msg("Cannot render the receiver template, using the default receiver")
+		return r.DefaultReceiver
+	}
+	name := buf.String()
+	if _, ok := r.knownReceivers[name]; !ok {
+		log.Debug().Str("receiver", name).Str("default", r.DefaultReceiver).Msg("Unknown receiver rendered, using the default receiver")
+		return r.DefaultReceiver
+	}
+	return name
+}
+
+// validateRanges checks the numeric bounds of the rule
+func (r *Rule) validateRanges() error {
+	if r.MinCount < 0 || r.MaxCount < 0 {
+		return fmt.Errorf("minCount and maxCount must not be negative, got %d and %d", r.MinCount, r.MaxCount)
+	}
+	if r.MaxCount > 0 && r.MaxCount < r.MinCount {
+		return fmt.Errorf("maxCount (%d) must not be less than minCount (%d)", r.MaxCount, r.MinCount)
+	}
+	if r.MinAge < 0 || r.MaxAge < 0 {
+		return fmt.Errorf("minAge and maxAge must not be negative, got %s and %s", r.MinAge, r.MaxAge)
+	}
+	if r.MaxAge > 0 && r.MaxAge < r.MinAge {
+		return fmt.Errorf("maxAge (%s) must not be less than minAge (%s)", r.MaxAge, r.MinAge)
+	}
+	return nil
 }
 
 type fieldMatcher struct {
 	pattern   *regexp.Regexp
+	field     string
 	ruleName  string
 	eventName string
 }
 
+// mapMatcher matches the values of a map of the event with the patterns of the rule for their keys
+type mapMatcher struct {
+	patterns map[string]*regexp.Regexp
+	field    string
+	rule     map[string]string
+	event    map[string]string
+}
+
 // MatchesEvent compares the rule to an event and returns a boolean value to indicate
 // whether the event is compatible with the rule. All fields are compared as regular expressions
 // so the user must keep that in mind while writing rules.
 //
 // Note: In production, patterns should be precompiled via PreCompilePatterns() during validation.
 // This method falls back to runtime compilation for testing and backward compatibility.
+func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
+	return len(r.failedFields(ev, false)) == 0
+}
+
+// failedFields returns the fields of the rule which the event does not match, none if it matches the rule. Unless
+// all is set, it stops at the first one.
 //
 //nolint:gocyclo
-func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
+func (r *Rule) failedFields(ev *kube.EnhancedEvent, all bool) []string {
+	var failed []string
+	// fail records a failed field, and tells whether to stop there
+	fail := func(field string) bool {
+		failed = append(failed, field)
+		return !all
+	}
+
 	// These matchers are just basic comparison matchers, if one of them fails, it means the event does not match the rule
+	owner := ev.InvolvedObject.Owner()
+	var related corev1.ObjectReference
+	if ev.Related != nil {
+		related = *ev.Related
+	}
 	matchers := []fieldMatcher{
-		{pattern: r.messagePattern, ruleName: r.Message, eventName: ev.Message},
-		{pattern: r.apiVersionPattern, ruleName: r.APIVersion, eventName: ev.InvolvedObject.APIVersion},
-		{pattern: r.kindPattern, ruleName: r.Kind, eventName: ev.InvolvedObject.Kind},
-		{pattern: r.namespacePattern, ruleName: r.Namespace, eventName: ev.Namespace},
-		{pattern: r.reasonPattern, ruleName: r.Reason, eventName: ev.Reason},
-		{pattern: r.typePattern, ruleName: r.Type, eventName: ev.Type},
-		{pattern: r.componentPattern, ruleName: r.Component, eventName: ev.Source.Component},
-		{pattern: r.hostPattern, ruleName: r.Host, eventName: ev.Source.Host},
+		{pattern: r.messagePattern, field: "message", ruleName: r.Message, eventName: ev.Message},
+		{pattern: r.apiVersionPattern, field: "apiVersion", ruleName: r.APIVersion, eventName: ev.InvolvedObject.APIVersion},
+		{pattern: r.kindPattern, field: "kind", ruleName: r.Kind, eventName: ev.InvolvedObject.Kind},
+		{pattern: r.namespacePattern, field: "namespace", ruleName: r.Namespace, eventName: ev.Namespace},
+		{pattern: r.reasonPattern, field: "reason", ruleName: r.Reason, eventName: ev.Reason},
+		{pattern: r.typePattern, field: "type", ruleName: r.Type, eventName: ev.Type},
+		{pattern: r.componentPattern, field: "component", ruleName: r.Component, eventName: ev.Source.Component},
+		{pattern: r.hostPattern, field: "host", ruleName: r.Host, eventName: ev.Source.Host},
+		{pattern: r.ownerKindPattern, field: "ownerKind", ruleName: r.OwnerKind, eventName: owner.Kind},
+		{pattern: r.ownerNamePattern, field: "ownerName", ruleName: r.OwnerName, eventName: owner.Name},
+		{pattern: r.namePattern, field: "name", ruleName: r.Name, eventName: ev.InvolvedObject.Name},
+		{pattern: r.fieldPathPattern, field: "fieldPath", ruleName: r.FieldPath, eventName: ev.InvolvedObject.FieldPath},
+		{pattern: r.controllerPattern, field: "reportingController", ruleName: r.ReportingController, eventName: ev.ReportingController},
+		{pattern: r.instancePattern, field: "reportingInstance", ruleName: r.ReportingInstance, eventName: ev.ReportingInstance},
+		{pattern: r.actionPattern, field: "action", ruleName: r.Action, eventName: ev.Action},
+		{pattern: r.relatedKindPattern, field: "relatedKind", ruleName: r.RelatedKind, eventName: related.Kind},
+		{pattern: r.relatedNamePattern, field: "relatedName", ruleName: r.RelatedName, eventName: related.Name},
 	}
 
 	for _, m := range matchers {
@@ -81,65 +243,98 @@ func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
 			continue
 		}
 
+		var matched bool
 		if m.pattern != nil {
-			if !m.pattern.MatchString(m.eventName) {
-				return false
-			}
+			matched = m.pattern.MatchString(m.eventName)
 		} else {
 			log.Debug().Msgf("Rule field '%s' is not precompiled, falling back to runtime compilation", m.ruleName)
-			if !matchString(m.ruleName, m.eventName) {
-				return false
-			}
+			matched = matchString(m.ruleName, m.eventName)
+		}
+		if !matched && fail(m.field) {
+			return failed
 		}
 	}
 
-	// Labels are also mutually exclusive, they all need to be present
-	if len(r.Labels) > 0 {
-		for k, v := range r.Labels {
-			val, ok := ev.InvolvedObject.Labels[k]
-			if !ok {
-				return false
-			}
-
-			if pattern := r.labelsPatterns[k]; pattern != nil {
-				if !pattern.MatchString(val) {
-					return false
-				}
-			} else {
-				log.Debug().Msgf("Rule label '%s' is not precompiled, falling back to runtime compilation", k)
-				if !matchString(v, val) {
-					return false
+	// Labels, annotations and custom fields are also mutually exclusive, they all need to be present
+	mapMatchers := []mapMatcher{
+		{patterns: r.labelsPatterns, field: "labels", rule: r.Labels, event: ev.InvolvedObject.Labels},
+		{patterns: r.annotationsPatterns, field: "annotations", rule: r.Annotations, event: ev.InvolvedObject.Annotations},
+		{patterns: r.namespaceLabelsPatterns, field: "namespaceLabels", rule: r.NamespaceLabels, event: ev.NamespaceLabels},
+		{patterns: r.namespaceAnnotationsPatterns, field: "namespaceAnnotations", rule: r.NamespaceAnnotations, event: ev.NamespaceAnnotations},
+		{patterns: r.fieldsPatterns, field: "fields", rule: r.Fields, event: ev.Fields},
+	}
+	for _, m := range mapMatchers {
+		for k, v := range m.rule {
+			val, ok := m.event[k]
+			if ok {
+				if pattern := m.patterns[k]; pattern != nil {
+					ok = pattern.MatchString(val)
+				} else {
+					log.Debug().Msgf("Rule %s key '%s' is not precompiled, falling back to runtime compilation", m.field, k)
+					ok = matchString(v, val)
 				}
 			}
+			if !ok && fail(m.field+"."+k) {
+				return failed
+			}
 		}
 	}
 
-	// Annotations are also mutually exclusive, they all need to be present
-	if len(r.Annotations) > 0 {
-		for k, v := range r.Annotations {
-			val, ok := ev.InvolvedObject.Annotations[k]
-			if !ok {
-				return false
+	if r.expressions != nil {
+		for i, m := range r.expressions {
+			if !m.matches(ev) && fail(fmt.Sprintf("matchExpressions[%d]", i)) {
+				return failed
 			}
+		}
+	} else {
+		for i, e := range r.MatchExpressions {
+			log.Debug().Msgf("Rule expression for '%s' is not precompiled, falling back to runtime compilation", e.Key)
+			m, err := compileExpression(e)
+			if (err != nil || !m.matches(ev)) && fail(fmt.Sprintf("matchExpressions[%d]", i)) {
+				return failed
+			}
+		}
+	}
 
-			if pattern := r.annotationsPatterns[k]; pattern != nil {
-				if !pattern.MatchString(val) {
-					return false
-				}
-			} else {
-				log.Debug().Msgf("Rule annotation '%s' is not precompiled, falling back to runtime compilation", k)
-				if !matchString(v, val) {
-					return false
-				}
+	if r.Expression != "" {
+		prg := r.program
+		matched := false
+		if prg == nil {
+			log.Debug().Msgf("Rule expression '%s' is not precompiled, falling back to runtime compilation", r.Expression)
+			var err error
+			if prg, err = compileCELExpression(r.Expression); err != nil {
+				prg = nil
+			}
+		}
+		if prg != nil {
+			var err error
+			matched, err = matchesCELExpression(prg, ev)
+			if err != nil {
+				log.Debug().Err(err).Str("expression", r.Expression).Msg("Cannot evaluate rule expression")
 			}
 		}
+		if !matched && fail("expression") {
+			return failed
+		}
 	}
 
 	// If minCount is not given via a config, it's already 0 and the count is already 1 and this passes.
-	if ev.Count < r.MinCount {
-		return false
+	if ev.Count < r.MinCount && fail("minCount") {
+		return failed
+	}
+	if r.MaxCount > 0 && ev.Count > r.MaxCount && fail("maxCount") {
+		return failed
+	}
+	if r.MinAge > 0 || r.MaxAge > 0 {
+		age := time.Since(ev.LastObserved())
+		if age < r.MinAge && fail("minAge") {
+			return failed
+		}
+		if r.MaxAge > 0 && age > r.MaxAge && fail("maxAge") {
+			return failed
+		}
 	}
 
 	// If it failed every step, it must match because our matchers are limiting
-	return true
+	return failed
 }
@@ -2,9 +2,13 @@ package exporter
 
 import (
 	"testing"
+	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestEmptyRule(t *testing.T) {
@@ -356,3 +360,175 @@ func TestCount(t *testing.T) {
 
 	assert.False(t, r.MatchesEvent(ev))
 }
+
+func TestMatchExpressions(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = "BackOff"
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Labels = map[string]string{"team": "payments", "tier": ""}
+
+	tests := []struct {
+		name  string
+		expr  MatchExpression
+		match bool
+	}{
+		{"match", MatchExpression{Key: "reason", Operator: OperatorMatch, Values: []string{"^Back"}}, true},
+		{"notMatch", MatchExpression{Key: "reason", Operator: OperatorNotMatch, Values: []string{"^Back"}}, false},
+		{"notMatch missing label", MatchExpression{Key: "labels.app", Operator: OperatorNotMatch, Values: []string{"nginx"}}, true},
+		{"in", MatchExpression{Key: "kind", Operator: OperatorIn, Values: []string{"Deployment", "Pod"}}, true},
+		{"in missing label", MatchExpression{Key: "labels.app", Operator: OperatorIn, Values: []string{""}}, false},
+		{"notIn", MatchExpression{Key: "reason", Operator: OperatorNotIn, Values: []string{"BackOff"}}, false},
+		{"notIn missing label", MatchExpression{Key: "labels.app", Operator: OperatorNotIn, Values: []string{"nginx"}}, true},
+		{"exists", MatchExpression{Key: "labels.team", Operator: OperatorExists}, true},
+		{"exists empty label", MatchExpression{Key: "labels.tier", Operator: OperatorExists}, true},
+		{"exists empty field", MatchExpression{Key: "message", Operator: OperatorExists}, false},
+		{"doesNotExist", MatchExpression{Key: "annotations.owner", Operator: OperatorDoesNotExist}, true},
+		{"event field", MatchExpression{Key: "involvedObject.kind", Operator: OperatorIn, Values: []string{"Pod"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Rule{MatchExpressions: []MatchExpression{tt.expr}}
+			assert.Equal(t, tt.match, r.MatchesEvent(ev))
+
+			cfg := Config{Route: Route{Match: []Rule{r}}}
+			require.NoError(t, cfg.PreCompilePatterns())
+			assert.Len(t, cfg.Route.Match[0].expressions, 1)
+			assert.Equal(t, tt.match, cfg.Route.Match[0].MatchesEvent(ev))
+		})
+	}
+}
+
+func TestMatchExpressions_Invalid(t *testing.T) {
+	for _, e := range []MatchExpression{
+		{Key: "unknown", Operator: OperatorExists},
+		{Key: "reason", Operator: "equals", Values: []string{"BackOff"}},
+		{Key: "reason", Operator: OperatorMatch, Values: []string{"(", "b"}},
+		{Key: "reason", Operator: OperatorMatch, Values: []string{"("}},
+		{Key: "reason", Operator: OperatorIn},
+		{Key: "labels.team", Operator: OperatorExists, Values: []string{"payments"}},
+	} {
+		cfg := Config{Route: Route{Drop: []Rule{{MatchExpressions: []MatchExpression{e}}}}}
+		assert.Error(t, cfg.PreCompilePatterns(), "%+v", e)
+	}
+}
+
+func TestOwnerRule(t *testing.T) {
+	controller := true
+	ev := &kube.EnhancedEvent{}
+	ev.InvolvedObject.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-5d8f", Controller: &controller}}
+
+	r := Rule{OwnerKind: "ReplicaSet", OwnerName: "api-.*"}
+	assert.True(t, r.MatchesEvent(ev))
+
+	// The resolved top owner takes precedence over the controller
+	ev.InvolvedObject.TopOwner = &metav1.OwnerReference{Kind: "Deployment", Name: "api"}
+	assert.False(t, r.MatchesEvent(ev))
+	compiled := mustCompileRule(t, Rule{OwnerKind: "^Deployment$", OwnerName: "^api$"})
+	assert.True(t, compiled.MatchesEvent(ev))
+
+	noOwner := Rule{OwnerKind: "Deployment"}
+	assert.False(t, noOwner.MatchesEvent(&kube.EnhancedEvent{}))
+}
+
+func TestEventFieldsRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.InvolvedObject.Name = "api-5d8f-x2x"
+	ev.InvolvedObject.FieldPath = "spec.containers{sidecar}"
+	ev.ReportingController = "kubelet"
+	ev.ReportingInstance = "node-1"
+	ev.Action = "Binding"
+	ev.Related = &corev1.ObjectReference{Kind: "Node", Name: "node-1"}
+
+	r := mustCompileRule(t, Rule{
+		Name:                "^api-",
+		FieldPath:           "sidecar",
+		ReportingController: "^kubelet$",
+		ReportingInstance:   "node-.*",
+		Action:              "Binding",
+		RelatedKind:         "^Node$",
+		RelatedName:         "node-1",
+	})
+	assert.True(t, r.MatchesEvent(ev))
+
+	r = mustCompileRule(t, Rule{RelatedKind: "Node"})
+	assert.False(t, r.MatchesEvent(&kube.EnhancedEvent{}))
+	r = mustCompileRule(t, Rule{FieldPath: "app"})
+	assert.False(t, r.MatchesEvent(ev))
+}
+
+func TestCountRange(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Count = 5
+
+	for _, tc := range []struct {
+		rule    Rule
+		matches bool
+	}{
+		{Rule{MinCount: 2, MaxCount: 5}, true},
+		{Rule{MinCount: 6}, false},
+		{Rule{MaxCount: 4}, false},
+		{Rule{MaxCount: 0}, true},
+	} {
+		assert.Equal(t, tc.matches, tc.rule.MatchesEvent(ev), "rule %+v", tc.rule)
+	}
+}
+
+func TestEventAge(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.LastTimestamp = metav1.NewTime(time.Now().Add(-10 * time.Minute))
+
+	assert.True(t, (&Rule{MaxAge: time.Hour}).MatchesEvent(ev))
+	assert.False(t, (&Rule{MaxAge: time.Minute}).MatchesEvent(ev))
+	assert.True(t, (&Rule{MinAge: 5 * time.Minute}).MatchesEvent(ev))
+	assert.False(t, (&Rule{MinAge: time.Hour}).MatchesEvent(ev))
+
+	// The event time of the new events API is used without last timestamp
+	ev = &kube.EnhancedEvent{}
+	ev.EventTime = metav1.NewMicroTime(time.Now().Add(-2 * time.Hour))
+	assert.False(t, (&Rule{MaxAge: time.Hour}).MatchesEvent(ev))
+}
+
+func TestRuleRanges_Invalid(t *testing.T) {
+	for _, rule := range []Rule{
+		{MinCount: -1},
+		{MaxCount: -1},
+		{MinCount: 5, MaxCount: 2},
+		{MinAge: -time.Second},
+		{MinAge: time.Hour, MaxAge: time.Minute},
+	} {
+		cfg := Config{Route: Route{Match: []Rule{rule}}}
+		assert.Error(t, cfg.PreCompilePatterns(), "rule %+v", rule)
+	}
+
+	cfg := Config{Route: Route{Match: []Rule{{MinCount: 2, MaxCount: 2, MinAge: time.Minute}}}}
+	require.NoError(t, cfg.PreCompilePatterns())
+}
+
+func TestNamespaceMetadataRule(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.NamespaceLabels = map[string]string{"tier": "critical", "team": "payments"}
+	ev.NamespaceAnnotations = map[string]string{"owner": "team-payments@example.com"}
+
+	r := Rule{NamespaceLabels: map[string]string{"tier": "critical"}}
+	assert.True(t, r.MatchesEvent(ev))
+
+	compiled := mustCompileRule(t, Rule{
+		NamespaceLabels:      map[string]string{"tier": "^(critical|high)$"},
+		NamespaceAnnotations: map[string]string{"owner": "@example\\.com$"},
+	})
+	assert.True(t, compiled.MatchesEvent(ev))
+
+	compiled = mustCompileRule(t, Rule{NamespaceLabels: map[string]string{"tier": "critical", "env": "prod"}})
+	assert.False(t, compiled.MatchesEvent(ev))
+	assert.Equal(t, []string{"namespaceLabels.env"}, compiled.failedFields(ev, true))
+
+	// The labels of the involved object are not the labels of its namespace
+	other := &kube.EnhancedEvent{}
+	other.InvolvedObject.Labels = map[string]string{"tier": "critical"}
+	assert.False(t, compiled.MatchesEvent(other))
+
+	expr := mustCompileRule(t, Rule{MatchExpressions: []MatchExpression{
+		{Key: "namespaceLabels.tier", Operator: OperatorIn, Values: []string{"critical"}},
+	}})
+	assert.True(t, expr.MatchesEvent(ev))
+}
@@ -0,0 +1,291 @@
+package exporter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+)
+
+// createdSilenceLabel labels the events muted by the silences created at runtime in the metrics
+const createdSilenceLabel = "api"
+
+// Silence mutes the events matching all its rules while it is active: from StartsAt until EndsAt, and within its
+// recurring window if it has one. Zero StartsAt and EndsAt leave it open on that side.
+type Silence struct {
+	StartsAt  time.Time      `yaml:"startsAt" json:"startsAt"`
+	EndsAt    time.Time      `yaml:"endsAt" json:"endsAt"`
+	Window    *SilenceWindow `yaml:"window" json:"window,omitempty"`
+	ID        string         `yaml:"id" json:"id"`
+	Comment   string         `yaml:"comment" json:"comment,omitempty"`
+	CreatedBy string         `yaml:"createdBy" json:"createdBy,omitempty"`
+	Match     []Rule         `yaml:"match" json:"match"`
+}
+
+// SilenceWindow is a recurring time window, e.g. business hours. It is open from Start until End on the given days,
+// a window whose End is before its Start spans midnight and ends on the next day.
+type SilenceWindow struct {
+	// Days are the weekdays the window opens on, e.g. Mon or Monday, empty means every day
+	Days []string `yaml:"days" json:"days,omitempty"`
+	// Start and End are times of the day as HH:MM, the same time for both means the whole day
+	Start string `yaml:"start" json:"start"`
+	End   string `yaml:"end" json:"end"`
+	// TimeZone is the IANA name of the time zone of the window, UTC by default
+	TimeZone string `yaml:"timeZone" json:"timeZone,omitempty"`
+	loc      *time.Location
+	start    int
+	end      int
+	days     [7]bool
+}
+
+// compile validates the silence and precompiles its rules
+func (s *Silence) compile() error {
+	if s.ID == "" {
+		return errors.New("silence id is required")
+	}
+	if len(s.Match) == 0 {
+		return fmt.Errorf("silence %q: at least one match rule is required", s.ID)
+	}
+	if s.EndsAt.IsZero() && s.Window == nil {
+		return fmt.Errorf("silence %q: endsAt or window is required", s.ID)
+	}
+	if !s.EndsAt.IsZero() && !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("silence %q: endsAt must be after startsAt", s.ID)
+	}
+	if s.Window != nil {
+		if err := s.Window.compile(); err != nil {
+			return fmt.Errorf("silence %q: %w", s.ID, err)
+		}
+	}
+	var c Config
+	for i := range s.Match {
+		rule := &s.Match[i]
+		if rule.Receiver != "" || len(rule.Receivers) > 0 {
+			return fmt.Errorf("silence %q: match[%d]: silence rules have no receivers", s.ID, i)
+		}
+		if err := c.preCompilePatternsHelper(rule); err != nil {
+			return fmt.Errorf("silence %q: match[%d]: %w", s.ID, i, err)
+		}
+	}
+	return nil
+}
+
+// active reports whether the silence mutes events at the given time
+func (s *Silence) active(now time.Time) bool {
+	if !s.StartsAt.IsZero() && now.Before(s.StartsAt) {
+		return false
+	}
+	if !s.EndsAt.IsZero() && !now.Before(s.EndsAt) {
+		return false
+	}
+	return s.Window == nil || s.Window.contains(now)
+}
+
+// expired reports whether the silence will never be active again
+func (s *Silence) expired(now time.Time) bool {
+	return !s.EndsAt.IsZero() && !now.Before(s.EndsAt)
+}
+
+func (s *Silence) matches(ev *kube.EnhancedEvent) bool {
+	for i := range s.Match {
+		if !s.Match[i].MatchesEvent(ev) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *SilenceWindow) compile() error {
+	var err error
+	w.loc = time.UTC
+	if w.TimeZone != "" {
+		if w.loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return fmt.Errorf("window: invalid timeZone: %w", err)
+		}
+	}
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		return fmt.Errorf("window: invalid start: %w", err)
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		return fmt.Errorf("window: invalid end: %w", err)
+	}
+	w.days = [7]bool{}
+	for _, d := range w.Days {
+		day, ok := parseWeekday(d)
+		if !ok {
+			return fmt.Errorf("window: invalid day %q", d)
+		}
+		w.days[day] = true
+	}
+	if len(w.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	return nil
+}
+
+// contains reports whether the window is open at the given time
+func (w *SilenceWindow) contains(now time.Time) bool {
+	t := now.In(w.loc)
+	minute := t.Hour()*60 + t.Minute()
+	today := w.days[t.Weekday()]
+	switch {
+	case w.start == w.end:
+		return today
+	case w.start < w.end:
+		return today && minute >= w.start && minute < w.end
+	default:
+		// The window spans midnight, its early part belongs to the day before
+		yesterday := w.days[(t.Weekday()+6)%7]
+		return (today && minute >= w.start) || (yesterday && minute < w.end)
+	}
+}
+
+// parseTimeOfDay returns the minutes since midnight of a HH:MM time
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// Silencer holds the silences of the configuration and the ones created at runtime, which outlive the reloads of
+// the configuration but not a restart. The engine checks it before routing an event.
+type Silencer struct {
+	metrics    atomic.Pointer[metrics.Store]
+	configured []Silence
+	created    map[string]*Silence
+	mu         sync.RWMutex
+}
+
+// NewSilencer returns a silencer with the silences of the configuration, which must be validated already
+func NewSilencer(configured []Silence) *Silencer {
+	return &Silencer{configured: configured, created: make(map[string]*Silence)}
+}
+
+// SetMetricsStore makes the silencer count the events it mutes in the store
+func (s *Silencer) SetMetricsStore(store *metrics.Store) {
+	s.metrics.Store(store)
+}
+
+// setConfigured replaces the silences of the configuration, on reload
+func (s *Silencer) setConfigured(configured []Silence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured = configured
+}
+
+// Silenced reports whether an active silence mutes the event, and counts it if so
+func (s *Silencer) Silenced(ev *kube.EnhancedEvent) bool {
+	return s.silencedBy(ev) != ""
+}
+
+// silencedBy returns the id of the active silence which mutes the event, and counts it. It is empty if none does.
+func (s *Silencer) silencedBy(ev *kube.EnhancedEvent) string {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, label := "", ""
+	for i := range s.configured {
+		if silence := &s.configured[i]; silence.active(now) && silence.matches(ev) {
+			id, label = silence.ID, silence.ID
+			break
+		}
+	}
+	if id == "" {
+		for _, silence := range s.created {
+			if silence.active(now) && silence.matches(ev) {
+				// The ids of the silences created at runtime are random, they would make a series each
+				id, label = silence.ID, createdSilenceLabel
+				break
+			}
+		}
+	}
+	if id == "" {
+		return ""
+	}
+	if store := s.metrics.Load(); store != nil {
+		store.EventsSilenced.WithLabelValues(label).Inc()
+	}
+	return id
+}
+
+// Add validates and adds a silence at runtime, under a new ID which is returned
+func (s *Silencer) Add(silence Silence) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	silence.ID = hex.EncodeToString(b)
+	now := time.Now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if err := silence.compile(); err != nil {
+		return "", err
+	}
+	if silence.expired(now) {
+		return "", fmt.Errorf("silence %q: endsAt is in the past", silence.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.created, func(_ string, v *Silence) bool { return v.expired(now) })
+	s.created[silence.ID] = &silence
+	return silence.ID, nil
+}
+
+// Expire removes a silence created at runtime, it reports whether there was one with the ID
+func (s *Silencer) Expire(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.created[id]; !ok {
+		return false
+	}
+	delete(s.created, id)
+	return true
+}
+
+// List returns the silences which are not expired, the ones of the configuration first
+func (s *Silencer) List() []Silence {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Silence
+	for _, silence := range s.configured {
+		if !silence.expired(now) {
+			list = append(list, silence)
+		}
+	}
+	created := slices.SortedFunc(maps.Values(s.created), func(a, b *Silence) int {
+		return a.StartsAt.Compare(b.StartsAt)
+	})
+	for _, silence := range created {
+		if !silence.expired(now) {
+			list = append(list, *silence)
+		}
+	}
+	return list
+}
@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SilencesPath is where the silences API is served
+const SilencesPath = "/api/v1/silences"
+
+// maxSilenceSize bounds the body of a request creating a silence
+const maxSilenceSize = 64 << 10
+
+// Handler serves the silences API, authenticated with the bearer token:
+//
+//	GET    /api/v1/silences       lists the silences which are not expired
+//	POST   /api/v1/silences       creates a silence from the JSON body and returns its id
+//	DELETE /api/v1/silences/{id}  expires a silence created through the API
+func (s *Silencer) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+SilencesPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.List())
+	})
+	mux.HandleFunc("POST "+SilencesPath, func(w http.ResponseWriter, r *http.Request) {
+		var silence Silence
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSilenceSize)).Decode(&silence); err != nil {
+			http.Error(w, "invalid silence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := s.Add(silence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Info().Str("id", id).Str("createdBy", silence.CreatedBy).Msg("Silence created")
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	})
+	mux.HandleFunc("DELETE "+SilencesPath+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if !s.Expire(id) {
+			http.Error(w, "no silence created through the API with this id", http.StatusNotFound)
+			return
+		}
+		log.Info().Str("id", id).Msg("Silence expired")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return requireBearerToken(token, mux)
+}
+
+// requireBearerToken rejects the requests which do not carry the token in their Authorization header
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonDuration is a duration encoded in JSON like "10m", as in the config file. A number is read as nanoseconds.
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid duration %s", data)
+		}
+		*d = jsonDuration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(v)
+	return nil
+}
+
+// MarshalJSON writes the rules of the silences API with their minAge and maxAge as durations like "10m"
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	return json.Marshal(struct {
+		plain
+		MinAge jsonDuration `json:"minAge,omitempty"`
+		MaxAge jsonDuration `json:"maxAge,omitempty"`
+	}{plain: plain(r), MinAge: jsonDuration(r.MinAge), MaxAge: jsonDuration(r.MaxAge)})
+}
+
+// UnmarshalJSON reads the rules of the silences API, whose minAge and maxAge are durations like "10m"
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	aux := struct {
+		*plain
+		MinAge jsonDuration `json:"minAge"`
+		MaxAge jsonDuration `json:"maxAge"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.MinAge, r.MaxAge = time.Duration(aux.MinAge), time.Duration(aux.MaxAge)
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Cannot write response")
+	}
+}
@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustCompileSilence(t *testing.T, s Silence) Silence {
+	t.Helper()
+	require.NoError(t, s.compile())
+	return s
+}
+
+func TestSilence_Active(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := mustCompileSilence(t, Silence{
+		ID:       "upgrade",
+		Match:    []Rule{{Reason: "NodeNotReady"}},
+		StartsAt: now.Add(-time.Hour),
+		EndsAt:   now.Add(time.Hour),
+	})
+	assert.True(t, s.active(now))
+	assert.False(t, s.active(now.Add(-2*time.Hour)))
+	assert.False(t, s.active(now.Add(time.Hour)))
+	assert.True(t, s.expired(now.Add(time.Hour)))
+}
+
+func TestSilenceWindow(t *testing.T) {
+	business := SilenceWindow{Days: []string{"Mon", "tuesday", "Wed", "Thu", "Fri"}, Start: "09:00", End: "17:00"}
+	require.NoError(t, business.compile())
+
+	// 2026-03-10 is a Tuesday
+	assert.True(t, business.contains(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)))
+	assert.False(t, business.contains(time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC)))
+	assert.False(t, business.contains(time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)))
+
+	// A window spanning midnight belongs to the day it opens on
+	nightly := SilenceWindow{Days: []string{"Sat"}, Start: "22:00", End: "04:00", TimeZone: "Europe/Berlin"}
+	require.NoError(t, nightly.compile())
+	berlin := nightly.loc
+	assert.True(t, nightly.contains(time.Date(2026, 3, 14, 23, 0, 0, 0, berlin)))
+	assert.True(t, nightly.contains(time.Date(2026, 3, 15, 3, 59, 0, 0, berlin)))
+	assert.False(t, nightly.contains(time.Date(2026, 3, 14, 3, 0, 0, 0, berlin)))
+	assert.False(t, nightly.contains(time.Date(2026, 3, 14, 20, 0, 0, 0, time.UTC)))
+
+	for _, w := range []SilenceWindow{
+		{Start: "9am", End: "17:00"},
+		{Start: "09:00", End: "25:00"},
+		{Start: "09:00", End: "17:00", Days: []string{"Mo"}},
+		{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus"},
+	} {
+		assert.Error(t, w.compile(), "window %+v", w)
+	}
+}
+
+func TestSilence_Invalid(t *testing.T) {
+	end := time.Now().Add(time.Hour)
+	for _, s := range []Silence{
+		{Match: []Rule{{Reason: "NodeNotReady"}}, EndsAt: end},
+		{ID: "empty", EndsAt: end},
+		{ID: "endless", Match: []Rule{{Reason: "NodeNotReady"}}},
+		{ID: "backwards", Match: []Rule{{Reason: "NodeNotReady"}}, StartsAt: end, EndsAt: end.Add(-time.Minute)},
+		{ID: "receiver", Match: []Rule{{Reason: "NodeNotReady", Receiver: "slack"}}, EndsAt: end},
+		{ID: "pattern", Match: []Rule{{Reason: "Node("}}, EndsAt: end},
+	} {
+		assert.Error(t, s.compile(), "silence %+v", s)
+	}
+}
+
+func TestReadConfig_Silences(t *testing.T) {
+	const yml = `
+silences:
+  - id: node-upgrade
+    comment: Planned node upgrades
+    startsAt: 2026-03-10T08:00:00Z
+    endsAt: 2026-03-10T12:00:00Z
+    match:
+      - reason: "NodeNotReady|Evicted"
+  - id: office-hours
+    window:
+      days: [Sat, Sun]
+      start: "00:00"
+      end: "00:00"
+      timeZone: Europe/Berlin
+    match:
+      - namespace: "sandbox"
+silencesAPI:
+  token: secret
+`
+	cfg := readConfig(t, yml)
+	require.NoError(t, cfg.validateSilences())
+	require.Len(t, cfg.Silences, 2)
+	assert.Equal(t, time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC), cfg.Silences[0].EndsAt.UTC())
+	assert.Equal(t, "secret", cfg.SilencesAPI.Token)
+
+	cfg.Silences[1].ID = "node-upgrade"
+	assert.Error(t, cfg.validateSilences())
+}
+
+func TestEngine_Silences(t *testing.T) {
+	store := newTestMetricsStore(t)
+	reg := &testReceiverRegistry{}
+	e := &Engine{
+		Registry: reg,
+		Route:    Route{Match: []Rule{{Receiver: "slack"}}},
+		Silences: NewSilencer([]Silence{mustCompileSilence(t, Silence{
+			ID:     "upgrade",
+			Match:  []Rule{{Reason: "NodeNotReady"}},
+			EndsAt: time.Now().Add(time.Hour),
+		})}),
+	}
+	e.SetMetricsStore(store)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = "NodeNotReady"
+	e.OnEvent(ev)
+	other := &kube.EnhancedEvent{}
+	other.Reason = "BackOff"
+	e.OnEvent(other)
+
+	assert.Equal(t, 1, reg.count("slack"))
+	assert.True(t, reg.isEventRcvd("slack", other))
+	assert.InDelta(t, 1, testutil.ToFloat64(store.EventsSilenced.WithLabelValues("upgrade")), 0)
+
+	// The silences created at runtime outlive a reload
+	_, err := e.Silences.Add(Silence{Match: []Rule{{Reason: "BackOff"}}, EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, e.Reload(&Config{Route: e.Route}))
+	e.OnEvent(ev)
+	e.OnEvent(other)
+	assert.Equal(t, 2, reg.count("slack"))
+	assert.InDelta(t, 1, testutil.ToFloat64(store.EventsSilenced.WithLabelValues("api")), 0)
+	// A series per configured silence, and a single one for those created at runtime
+	assert.Equal(t, 2, testutil.CollectAndCount(store.EventsSilenced))
+}
+
+func TestSilencer_Handler(t *testing.T) {
+	s := NewSilencer(nil)
+	h := s.Handler("secret")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, SilencesPath, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, SilencesPath, "wrong", "").Code)
+
+	endsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec := do(http.MethodPost, SilencesPath, "secret",
+		`{"match": [{"reason": "NodeNotReady", "minAge": "10m"}], "endsAt": "`+endsAt+`", "createdBy": "ops"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotEmpty(t, created["id"])
+
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = "NodeNotReady"
+	assert.True(t, s.Silenced(ev))
+
+	rec = do(http.MethodGet, SilencesPath, "secret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []Silence
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "ops", list[0].CreatedBy)
+	assert.Equal(t, 10*time.Minute, list[0].Match[0].MinAge)
+	assert.Contains(t, rec.Body.String(), `"minAge":"10m0s"`)
+	assert.NotContains(t, rec.Body.String(), `"maxAge"`)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, SilencesPath, "secret", `{"match": []}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, SilencesPath, "secret", `{`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, SilencesPath, "secret",
+		`{"match": [{"reason": "NodeNotReady", "maxAge": "soon"}], "endsAt": "`+endsAt+`"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, SilencesPath+"/"+created["id"], "secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, SilencesPath+"/"+created["id"], "secret", "").Code)
+	assert.False(t, s.Silenced(ev))
+}
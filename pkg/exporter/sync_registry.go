@@ -20,15 +20,23 @@ func (s *SyncRegistry) SendEvent(name string, event *kube.EnhancedEvent) {
 	}
 }
 
-func (s *SyncRegistry) Register(name string, sink sinks.Sink) {
+func (s *SyncRegistry) Register(name string, sink sinks.Sink, _ *sinks.ReceiverConfig) error {
 	if s.reg == nil {
 		s.reg = make(map[string]sinks.Sink)
 	}
 
 	s.reg[name] = sink
+	return nil
 }
 
-func (s *SyncRegistry) Close() {
+func (s *SyncRegistry) Unregister(name string) {
+	if sink, ok := s.reg[name]; ok {
+		sink.Close()
+		delete(s.reg, name)
+	}
+}
+
+func (s *SyncRegistry) Close(_ context.Context) {
 	for name, sink := range s.reg {
 		log.Info().Str("sink", name).Msg("Closing sink")
 		sink.Close()
@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/rs/zerolog"
+)
+
+// RoutesPath is where the routing traces are served
+const RoutesPath = "/debug/routes"
+
+// Results of the steps of a routing trace
+const (
+	StepDropped    = "dropped"
+	StepNotMatched = "notMatched"
+	StepMatched    = "matched"
+	StepSuppressed = "suppressed"
+	StepStopped    = "stopped"
+)
+
+// RouteTrace records how an event was routed: the silence or the annotation which muted it, or the steps of the
+// routes which processed it and the receivers it was sent to
+type RouteTrace struct {
+	Time      time.Time   `json:"time"`
+	Event     TracedEvent `json:"event"`
+	Silence   string      `json:"silence,omitempty"`
+	IgnoredBy string      `json:"ignoredBy,omitempty"`
+	Steps     []RouteStep `json:"steps,omitempty"`
+	Receivers []string    `json:"receivers"`
+	DryRun    bool        `json:"dryRun,omitempty"`
+}
+
+// TracedEvent identifies the event of a trace
+type TracedEvent struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	Count     int32  `json:"count"`
+}
+
+// RouteStep is a decision of a route: a drop rule which hit, a match rule which failed with the fields it failed on,
+// a match rule which matched with the receivers it chose, a repeat suppressed by the route or a route which stopped
+// the processing of its following siblings
+type RouteStep struct {
+	Route     string   `json:"route"`
+	Rule      string   `json:"rule,omitempty"`
+	Result    string   `json:"result"`
+	Failed    []string `json:"failed,omitempty"`
+	Receivers []string `json:"receivers,omitempty"`
+}
+
+func newRouteTrace(ev *kube.EnhancedEvent) *RouteTrace {
+	return &RouteTrace{
+		Time: time.Now(),
+		Event: TracedEvent{
+			Namespace: ev.Namespace,
+			Kind:      ev.InvolvedObject.Kind,
+			Name:      ev.InvolvedObject.Name,
+			Reason:    ev.Reason,
+			Type:      ev.Type,
+			Message:   ev.Message,
+			Count:     ev.Count,
+		},
+		Receivers: []string{},
+	}
+}
+
+func (t *RouteTrace) add(step RouteStep) {
+	t.Steps = append(t.Steps, step)
+	t.Receivers = append(t.Receivers, step.Receivers...)
+}
+
+// MarshalZerologObject logs the trace as the fields of a log entry
+func (t *RouteTrace) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("namespace", t.Event.Namespace).
+		Str("kind", t.Event.Kind).
+		Str("name", t.Event.Name).
+		Str("reason", t.Event.Reason).
+		Strs("receivers", t.Receivers)
+	if t.Silence != "" {
+		e.Str("silence", t.Silence)
+	}
+	if t.IgnoredBy != "" {
+		e.Str("ignoredBy", t.IgnoredBy)
+	}
+	e.Interface("steps", t.Steps)
+}
+
+// RouteTracer keeps the traces of the last events
+type RouteTracer struct {
+	traces []*RouteTrace
+	// next is the position of the next trace in the ring
+	next int
+	full bool
+	mu   sync.Mutex
+}
+
+// NewRouteTracer returns a tracer keeping the last size traces
+func NewRouteTracer(size int) *RouteTracer {
+	return &RouteTracer{traces: make([]*RouteTrace, size)}
+}
+
+func (r *RouteTracer) record(t *RouteTrace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.traces[r.next] = t
+	r.next = (r.next + 1) % len(r.traces)
+	r.full = r.full || r.next == 0
+}
+
+// Traces returns the kept traces, the latest first
+func (r *RouteTracer) Traces() []*RouteTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var traces []*RouteTrace
+	if r.full {
+		traces = append(traces, r.traces[r.next:]...)
+	}
+	traces = append(traces, r.traces[:r.next]...)
+	slices.Reverse(traces)
+	return traces
+}
+
+// Handler serves the kept traces as JSON, the latest first, authenticated with the bearer token since they hold the
+// messages of the events
+func (r *RouteTracer) Handler(token string) http.Handler {
+	return requireBearerToken(token, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, r.Traces())
+	}))
+}
+
+// dryRunRegistry stands in for the registry in dry-run mode, the events routed to it are only traced
+type dryRunRegistry struct{}
+
+func (dryRunRegistry) SendEvent(string, *kube.EnhancedEvent)                    {}
+func (dryRunRegistry) Register(string, sinks.Sink, *sinks.ReceiverConfig) error { return nil }
+func (dryRunRegistry) Unregister(string)                                        {}
+func (dryRunRegistry) Close(context.Context)                                    {}
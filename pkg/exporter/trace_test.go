@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteTrace(t *testing.T) {
+	stop := false
+	route := Route{
+		Routes: []Route{
+			{Drop: []Rule{{Namespace: "kube-system"}}, Match: []Rule{{Receiver: "all"}}},
+			{Match: []Rule{{Type: "Normal", Reason: "Pulled", Receiver: "normal"}}},
+			{Match: []Rule{{Type: "Warning", Receivers: []string{"slack", "opsgenie"}}}, Continue: &stop},
+			{Match: []Rule{{Receiver: "never"}}},
+		},
+	}
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "kube-system"
+	ev.Type = "Warning"
+	ev.Reason = "BackOff"
+	reg := testReceiverRegistry{}
+	trace := newRouteTrace(ev)
+	route.processEvent(ev, &reg, trace, "route")
+
+	assert.Equal(t, []RouteStep{
+		{Route: "route.routes[0]", Rule: "drop[0]", Result: StepDropped},
+		{Route: "route.routes[1]", Rule: "match[0]", Result: StepNotMatched, Failed: []string{"reason", "type"}},
+		{Route: "route.routes[2]", Rule: "match[0]", Result: StepMatched, Receivers: []string{"slack", "opsgenie"}},
+		{Route: "route.routes[2]", Result: StepStopped},
+	}, trace.Steps)
+	assert.Equal(t, []string{"slack", "opsgenie"}, trace.Receivers)
+	assert.Equal(t, "BackOff", trace.Event.Reason)
+	assert.Equal(t, 1, reg.count("slack"))
+}
+
+func TestRouteTracer(t *testing.T) {
+	tracer := NewRouteTracer(2)
+	assert.Empty(t, tracer.Traces())
+
+	for _, reason := range []string{"first", "second", "third"} {
+		ev := &kube.EnhancedEvent{}
+		ev.Reason = reason
+		tracer.record(newRouteTrace(ev))
+	}
+	traces := tracer.Traces()
+	require.Len(t, traces, 2)
+	assert.Equal(t, "third", traces[0].Event.Reason)
+	assert.Equal(t, "second", traces[1].Event.Reason)
+
+	handler := tracer.Handler("secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RoutesPath, nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, RoutesPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served []RouteTrace
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	require.Len(t, served, 2)
+	assert.Equal(t, "third", served[0].Event.Reason)
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	reg := &testReceiverRegistry{}
+	cfg := &Config{
+		Route:       Route{Match: []Rule{{Receiver: "stdout"}}},
+		Receivers:   []sinks.ReceiverConfig{{Name: "stdout", Stdout: &sinks.StdoutConfig{}}},
+		DryRun:      true,
+		RouteTraces: 10,
+	}
+	e := NewEngine(cfg, reg)
+	require.NotNil(t, e.Traces)
+
+	ev := &kube.EnhancedEvent{}
+	ev.Reason = "BackOff"
+	e.OnEvent(ev)
+
+	assert.Equal(t, 0, reg.count("stdout"))
+	traces := e.Traces.Traces()
+	require.Len(t, traces, 1)
+	assert.True(t, traces[0].DryRun)
+	assert.Equal(t, []string{"stdout"}, traces[0].Receivers)
+
+	// A reload only swaps the route, no sink is initialized
+	require.NoError(t, e.Reload(&Config{
+		Route:     Route{Match: []Rule{{Receiver: "broken"}}},
+		Receivers: []sinks.ReceiverConfig{{Name: "broken"}},
+	}))
+	e.OnEvent(ev)
+	assert.Equal(t, []string{"broken"}, e.Traces.Traces()[0].Receivers)
+}
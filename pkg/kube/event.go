@@ -15,6 +15,43 @@ type EnhancedEvent struct {
 	corev1.Event   `json:",inline"`
 	ClusterName    string                  `json:"clusterName"`
 	InvolvedObject EnhancedObjectReference `json:"involvedObject"`
+	// NamespaceLabels and NamespaceAnnotations are those of the namespace of the event, when the namespace
+	// metadata is enabled
+	NamespaceLabels      map[string]string `json:"namespaceLabels,omitempty"`
+	NamespaceAnnotations map[string]string `json:"namespaceAnnotations,omitempty"`
+	// Fields are the custom fields the processors set, e.g. a static env or a value extracted from the message
+	Fields map[string]string `json:"fields,omitempty"`
+	// DeadLetter is set when the event is forwarded to a dead-letter receiver
+	DeadLetter *DeadLetter `json:"deadLetter,omitempty"`
+	// Dedup is set on the reminders of an event whose repeats are suppressed
+	Dedup *Dedup `json:"dedup,omitempty"`
+	// Group is set on the notification of a group of events, which is the latest event of the group
+	Group *Group `json:"group,omitempty"`
+}
+
+// Group is a notification for the events which share the values of the grouping fields
+type Group struct {
+	Key    string            `json:"key"`
+	Labels map[string]string `json:"labels"`
+	Events []EnhancedEvent   `json:"events"`
+	// Omitted is the number of events of the group which are not listed in Events, beyond its max events
+	Omitted int `json:"omitted"`
+}
+
+// Dedup counts the repeats of an event which were suppressed since the last time it was sent
+type Dedup struct {
+	Fingerprint string    `json:"fingerprint"`
+	Suppressed  int       `json:"suppressed"`
+	FirstSeen   time.Time `json:"firstSeen"`
+}
+
+// DeadLetter describes why an event could not be delivered to the receiver it was routed to
+type DeadLetter struct {
+	Receiver         string    `json:"receiver"`
+	Error            string    `json:"error"`
+	Attempts         int       `json:"attempts"`
+	FirstAttemptTime time.Time `json:"firstAttemptTime"`
+	LastAttemptTime  time.Time `json:"lastAttemptTime"`
 }
 
 // DeDot replaces all dots in the labels and annotations with underscores. This is required for example in the
@@ -29,6 +66,8 @@ func (e *EnhancedEvent) DeDot() EnhancedEvent {
 	c.Annotations = dedotMap(e.Annotations)
 	c.InvolvedObject.Labels = dedotMap(e.InvolvedObject.Labels)
 	c.InvolvedObject.Annotations = dedotMap(e.InvolvedObject.Annotations)
+	c.NamespaceLabels = dedotMap(e.NamespaceLabels)
+	c.NamespaceAnnotations = dedotMap(e.NamespaceAnnotations)
 	return c
 }
 
@@ -49,7 +88,34 @@ type EnhancedObjectReference struct {
 	Labels                 map[string]string       `json:"labels,omitempty"`
 	Annotations            map[string]string       `json:"annotations,omitempty"`
 	OwnerReferences        []metav1.OwnerReference `json:"ownerReferences,omitempty"`
-	Deleted                bool                    `json:"deleted"`
+	// TopOwner is the controller at the top of the owner chain, e.g. the Deployment of a Pod, it is only resolved
+	// when enabled
+	TopOwner *metav1.OwnerReference `json:"topOwner,omitempty"`
+	Deleted  bool                   `json:"deleted"`
+}
+
+// Owner returns the owner of the object which rules and templates refer to: its top owner when it is resolved,
+// otherwise its controller, or its first owner if none is the controller. It is empty if the object has no owner.
+func (r *EnhancedObjectReference) Owner() metav1.OwnerReference {
+	if owner := r.owner(); owner != nil {
+		return *owner
+	}
+	return metav1.OwnerReference{}
+}
+
+func (r *EnhancedObjectReference) owner() *metav1.OwnerReference {
+	if r.TopOwner != nil {
+		return r.TopOwner
+	}
+	for i := range r.OwnerReferences {
+		if c := r.OwnerReferences[i].Controller; c != nil && *c {
+			return &r.OwnerReferences[i]
+		}
+	}
+	if len(r.OwnerReferences) > 0 {
+		return &r.OwnerReferences[0]
+	}
+	return nil
 }
 
 // ToJSON does not return an error because we are %99 confident it is JSON serializable.
@@ -63,6 +129,22 @@ func (e *EnhancedEvent) ToJSON() []byte {
 	return b
 }
 
+// LastObserved returns when the event was observed last
+func (e *EnhancedEvent) LastObserved() time.Time {
+	return lastObserved(&e.Event)
+}
+
+// lastObserved uses the most recent timestamp: series, then LastTimestamp, then EventTime
+func lastObserved(event *corev1.Event) time.Time {
+	if event.Series != nil && !event.Series.LastObservedTime.Time.IsZero() {
+		return event.Series.LastObservedTime.Time
+	}
+	if !event.LastTimestamp.Time.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
+
 func (e *EnhancedEvent) GetTimestampMs() int64 {
 	timestamp := e.FirstTimestamp.Time
 	if timestamp.IsZero() {
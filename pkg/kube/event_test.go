@@ -2,6 +2,7 @@ package kube
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
@@ -63,6 +64,17 @@ func TestEnhancedEvent_DeDot(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "dedot namespace metadata",
+			in: EnhancedEvent{
+				NamespaceLabels:      map[string]string{"kubernetes.io/metadata.name": "payments"},
+				NamespaceAnnotations: map[string]string{"owner": "team"},
+			},
+			want: EnhancedEvent{
+				NamespaceLabels:      map[string]string{"kubernetes_io/metadata_name": "payments"},
+				NamespaceAnnotations: map[string]string{"owner": "team"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -102,3 +114,88 @@ func TestEnhancedEvent_DeDot_MustNotAlternateOriginal(t *testing.T) {
 	in.DeDot()
 	assert.EqualValues(t, expected, in)
 }
+
+func TestCompileField(t *testing.T) {
+	ev := &EnhancedEvent{}
+	ev.Namespace = "default"
+	ev.InvolvedObject.Kind = "Pod"
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	controller := true
+	ev.InvolvedObject.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "Node", Name: "node-1"},
+		{Kind: "ReplicaSet", Name: "nginx-5d8f", Controller: &controller},
+	}
+
+	for path, want := range map[string]string{
+		"namespace":                  "default",
+		"involvedObject.owner.kind":  "ReplicaSet",
+		"involvedObject.owner.name":  "nginx-5d8f",
+		"involvedObject.kind":        "Pod",
+		"involvedObject.labels.app":  "nginx",
+		"involvedObject.labels.none": "",
+	} {
+		get, err := CompileField(path)
+		require.NoError(t, err)
+		got, _ := get(ev)
+		assert.Equal(t, want, got, path)
+	}
+
+	get, _ := CompileField("involvedObject.labels.none")
+	_, ok := get(ev)
+	assert.False(t, ok)
+
+	// The top owner takes precedence once it is resolved
+	ev.InvolvedObject.TopOwner = &metav1.OwnerReference{Kind: "Deployment", Name: "nginx"}
+	get, _ = CompileField("involvedObject.owner.kind")
+	kind, _ := get(ev)
+	assert.Equal(t, "Deployment", kind)
+	assert.Equal(t, "nginx", ev.InvolvedObject.Owner().Name)
+
+	_, err := CompileField("involvedObject.labels.")
+	assert.Error(t, err)
+	_, err = CompileField("unknown")
+	assert.Error(t, err)
+}
+
+func TestCompileFieldSetter(t *testing.T) {
+	labels := map[string]string{"app": "nginx", "team": "payments"}
+	ev := &EnhancedEvent{}
+	ev.InvolvedObject.Labels = labels
+
+	set, err := CompileFieldSetter("fields.env")
+	require.NoError(t, err)
+	set(ev, "prod")
+	assert.Equal(t, map[string]string{"env": "prod"}, ev.Fields)
+
+	set, err = CompileFieldSetter("message")
+	require.NoError(t, err)
+	set(ev, "redacted")
+	assert.Equal(t, "redacted", ev.Message)
+
+	// The maps are copied, those of the object cache are left unchanged
+	set, _ = CompileFieldSetter("involvedObject.labels.app")
+	set(ev, "api")
+	drop, err := CompileFieldDropper("involvedObject.labels.team")
+	require.NoError(t, err)
+	drop(ev)
+	assert.Equal(t, map[string]string{"app": "api"}, ev.InvolvedObject.Labels)
+	assert.Equal(t, map[string]string{"app": "nginx", "team": "payments"}, labels)
+
+	drop, err = CompileFieldDropper("involvedObject.labels")
+	require.NoError(t, err)
+	drop(ev)
+	assert.Nil(t, ev.InvolvedObject.Labels)
+
+	get, err := CompileField("fields.env")
+	require.NoError(t, err)
+	env, ok := get(ev)
+	assert.True(t, ok)
+	assert.Equal(t, "prod", env)
+
+	for _, path := range []string{"namespace", "involvedObject.name", "fields.", "unknown"} {
+		_, err = CompileFieldSetter(path)
+		assert.Error(t, err, path)
+	}
+	_, err = CompileFieldDropper("involvedObject.kind")
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package kube
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FieldGetter returns the value of a field of an event, and whether the event has the field
+type FieldGetter func(ev *EnhancedEvent) (string, bool)
+
+// FieldSetter sets the value of a field of an event
+type FieldSetter func(ev *EnhancedEvent, value string)
+
+// FieldDropper removes a field from an event
+type FieldDropper func(ev *EnhancedEvent)
+
+// eventFields are the fields which can be referenced by their path, named like in the JSON form of the event. A field
+// exists when it is not empty.
+var eventFields = map[string]func(ev *EnhancedEvent) string{
+	"namespace":           func(ev *EnhancedEvent) string { return ev.Namespace },
+	"name":                func(ev *EnhancedEvent) string { return ev.Name },
+	"reason":              func(ev *EnhancedEvent) string { return ev.Reason },
+	"message":             func(ev *EnhancedEvent) string { return ev.Message },
+	"type":                func(ev *EnhancedEvent) string { return ev.Type },
+	"action":              func(ev *EnhancedEvent) string { return ev.Action },
+	"clusterName":         func(ev *EnhancedEvent) string { return ev.ClusterName },
+	"reportingController": func(ev *EnhancedEvent) string { return ev.ReportingController },
+	"reportingInstance":   func(ev *EnhancedEvent) string { return ev.ReportingInstance },
+	"source.component":    func(ev *EnhancedEvent) string { return ev.Source.Component },
+	"source.host":         func(ev *EnhancedEvent) string { return ev.Source.Host },
+
+	"involvedObject.kind":       func(ev *EnhancedEvent) string { return ev.InvolvedObject.Kind },
+	"involvedObject.name":       func(ev *EnhancedEvent) string { return ev.InvolvedObject.Name },
+	"involvedObject.namespace":  func(ev *EnhancedEvent) string { return ev.InvolvedObject.Namespace },
+	"involvedObject.apiVersion": func(ev *EnhancedEvent) string { return ev.InvolvedObject.APIVersion },
+	"involvedObject.uid":        func(ev *EnhancedEvent) string { return string(ev.InvolvedObject.UID) },
+	"involvedObject.fieldPath":  func(ev *EnhancedEvent) string { return ev.InvolvedObject.FieldPath },
+
+	"related.kind":      func(ev *EnhancedEvent) string { return related(ev).Kind },
+	"related.name":      func(ev *EnhancedEvent) string { return related(ev).Name },
+	"related.namespace": func(ev *EnhancedEvent) string { return related(ev).Namespace },
+}
+
+// related returns the related object of the event, it is empty if the event has none
+func related(ev *EnhancedEvent) corev1.ObjectReference {
+	if ev.Related == nil {
+		return corev1.ObjectReference{}
+	}
+	return *ev.Related
+}
+
+// ownerFields are the fields of the owner of the involved object, its top owner when it is resolved or else its
+// controller. They exist when it has an owner.
+var ownerFields = map[string]func(owner *metav1.OwnerReference) string{
+	"involvedObject.owner.kind": func(owner *metav1.OwnerReference) string { return owner.Kind },
+	"involvedObject.owner.name": func(owner *metav1.OwnerReference) string { return owner.Name },
+}
+
+// mapFields are the prefixes of the fields which look up a key in a map of the event
+var mapFields = map[string]func(ev *EnhancedEvent) *map[string]string{
+	"involvedObject.labels.":      func(ev *EnhancedEvent) *map[string]string { return &ev.InvolvedObject.Labels },
+	"involvedObject.annotations.": func(ev *EnhancedEvent) *map[string]string { return &ev.InvolvedObject.Annotations },
+	"namespaceLabels.":            func(ev *EnhancedEvent) *map[string]string { return &ev.NamespaceLabels },
+	"namespaceAnnotations.":       func(ev *EnhancedEvent) *map[string]string { return &ev.NamespaceAnnotations },
+	"fields.":                     func(ev *EnhancedEvent) *map[string]string { return &ev.Fields },
+}
+
+// writableFields are the fields besides the map fields which processors can set and drop
+var writableFields = map[string]func(ev *EnhancedEvent) *string{
+	"reason":              func(ev *EnhancedEvent) *string { return &ev.Reason },
+	"message":             func(ev *EnhancedEvent) *string { return &ev.Message },
+	"type":                func(ev *EnhancedEvent) *string { return &ev.Type },
+	"action":              func(ev *EnhancedEvent) *string { return &ev.Action },
+	"clusterName":         func(ev *EnhancedEvent) *string { return &ev.ClusterName },
+	"reportingController": func(ev *EnhancedEvent) *string { return &ev.ReportingController },
+	"reportingInstance":   func(ev *EnhancedEvent) *string { return &ev.ReportingInstance },
+	"source.component":    func(ev *EnhancedEvent) *string { return &ev.Source.Component },
+	"source.host":         func(ev *EnhancedEvent) *string { return &ev.Source.Host },
+}
+
+// CompileField returns the getter of the field of an event at path, e.g. "namespace", "involvedObject.kind" or
+// "involvedObject.labels.app". It fails if the path does not name a known field.
+func CompileField(path string) (FieldGetter, error) {
+	if get, ok := eventFields[path]; ok {
+		return func(ev *EnhancedEvent) (string, bool) {
+			v := get(ev)
+			return v, v != ""
+		}, nil
+	}
+	if get, ok := ownerFields[path]; ok {
+		return func(ev *EnhancedEvent) (string, bool) {
+			if owner := ev.InvolvedObject.owner(); owner != nil {
+				return get(owner), true
+			}
+			return "", false
+		}, nil
+	}
+	for prefix, getMap := range mapFields {
+		key, ok := strings.CutPrefix(path, prefix)
+		if !ok {
+			continue
+		}
+		if key == "" {
+			return nil, fmt.Errorf("field %q is missing the key", path)
+		}
+		return func(ev *EnhancedEvent) (string, bool) {
+			v, ok := (*getMap(ev))[key]
+			return v, ok
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown event field %q", path)
+}
+
+// mapField returns the getter of the map of the field at path and the key it names, the key is empty if the path
+// names the whole map, e.g. "involvedObject.annotations"
+func mapField(path string) (func(ev *EnhancedEvent) *map[string]string, string, bool) {
+	for prefix, getMap := range mapFields {
+		if path+"." == prefix {
+			return getMap, "", true
+		}
+		if key, ok := strings.CutPrefix(path, prefix); ok {
+			return getMap, key, true
+		}
+	}
+	return nil, "", false
+}
+
+// CompileFieldSetter returns the setter of the field of an event at path, e.g. "message" or "fields.env". The maps of
+// the event are never modified in place, they may be shared with other events: a copy of the map is set instead.
+func CompileFieldSetter(path string) (FieldSetter, error) {
+	if get, ok := writableFields[path]; ok {
+		return func(ev *EnhancedEvent, value string) { *get(ev) = value }, nil
+	}
+	getMap, key, ok := mapField(path)
+	if !ok {
+		return nil, fmt.Errorf("field %q cannot be set", path)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("field %q is missing the key", path)
+	}
+	return func(ev *EnhancedEvent, value string) {
+		m := getMap(ev)
+		c := make(map[string]string, len(*m)+1)
+		maps.Copy(c, *m)
+		c[key] = value
+		*m = c
+	}, nil
+}
+
+// CompileFieldDropper returns the function removing the field of an event at path, e.g. "message",
+// "involvedObject.annotations.owner" or a whole map like "involvedObject.annotations". Like setting a field, dropping
+// a key sets a copy of the map.
+func CompileFieldDropper(path string) (FieldDropper, error) {
+	if get, ok := writableFields[path]; ok {
+		return func(ev *EnhancedEvent) { *get(ev) = "" }, nil
+	}
+	getMap, key, ok := mapField(path)
+	if !ok {
+		return nil, fmt.Errorf("field %q cannot be dropped", path)
+	}
+	if key == "" {
+		return func(ev *EnhancedEvent) { *getMap(ev) = nil }, nil
+	}
+	return func(ev *EnhancedEvent) {
+		m := getMap(ev)
+		if _, ok := (*m)[key]; ok {
+			c := maps.Clone(*m)
+			delete(c, key)
+			*m = c
+		}
+	}, nil
+}
@@ -134,3 +134,44 @@ func (o *objectMetadataCache) getObjectMetadata(reference *v1.ObjectReference, c
 	o.cache.Add(cacheKey, cachedMetadata{metadata: om, fetchedAt: time.Now()})
 	return om, nil
 }
+
+// maxOwnerDepth bounds the owner chain followed by resolveTopOwner, a deeper chain is cut there
+const maxOwnerDepth = 5
+
+// resolveTopOwner follows the controllers of the owners of an object in the namespace, e.g. from the ReplicaSet of a
+// Pod to its Deployment or from a Job to its CronJob, and returns the controller at the top of the chain. It returns
+// nil if the object has no controller. When an owner cannot be looked up, the chain stops at the last known one.
+func resolveTopOwner(provider objectMetadataProvider, namespace string, owners []metav1.OwnerReference, clientset kubernetes.Interface, dynClient dynamic.Interface, metricsStore *metrics.Store) *metav1.OwnerReference {
+	var top *metav1.OwnerReference
+	for range maxOwnerDepth {
+		owner := controllerOf(owners)
+		if owner == nil {
+			break
+		}
+		top = owner
+		om, err := provider.getObjectMetadata(&v1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name,
+			UID:        owner.UID,
+			Namespace:  namespace,
+		}, clientset, dynClient, metricsStore)
+		if err != nil {
+			log.Debug().Err(err).Str("kind", owner.Kind).Str("name", owner.Name).Msg("Cannot look up owner, stopping the owner chain")
+			break
+		}
+		owners = om.OwnerReferences
+	}
+	return top
+}
+
+// controllerOf returns a copy of the owner which is the controller, if any
+func controllerOf(owners []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range owners {
+		if c := owners[i].Controller; c != nil && *c {
+			owner := owners[i]
+			return &owner
+		}
+	}
+	return nil
+}
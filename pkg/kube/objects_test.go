@@ -1,6 +1,7 @@
 package kube
 
 import (
+	"errors"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -13,7 +14,9 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
 	dynfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
 
@@ -151,3 +154,46 @@ func TestGetObjectMetadata_TTLExpiryTriggersRefresh(t *testing.T) {
 
 	assert.Equal(t, int32(2), atomic.LoadInt32(&getCalls), "expected cache refresh after TTL expiry")
 }
+
+// ownerChainProvider returns the owners of the objects by name, and fails for the others
+type ownerChainProvider map[string][]metav1.OwnerReference
+
+func (p ownerChainProvider) getObjectMetadata(reference *corev1.ObjectReference, _ kubernetes.Interface, _ dynamic.Interface, _ *metrics.Store) (objectMetadata, error) {
+	owners, ok := p[reference.Kind+"/"+reference.Name]
+	if !ok {
+		return objectMetadata{}, errors.New("forbidden")
+	}
+	return objectMetadata{OwnerReferences: owners}, nil
+}
+
+func controllerRef(kind, name string) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{Kind: kind, Name: name, Controller: &controller}
+}
+
+func TestResolveTopOwner(t *testing.T) {
+	provider := ownerChainProvider{
+		"ReplicaSet/nginx-5d8f": {controllerRef("Deployment", "nginx")},
+		"Deployment/nginx":      nil,
+		"Job/backup-28000000":   {controllerRef("CronJob", "backup")},
+		"CronJob/backup":        {},
+	}
+
+	top := resolveTopOwner(provider, "default", []metav1.OwnerReference{controllerRef("ReplicaSet", "nginx-5d8f")}, nil, nil, nil)
+	require.NotNil(t, top)
+	assert.Equal(t, "Deployment", top.Kind)
+	assert.Equal(t, "nginx", top.Name)
+
+	top = resolveTopOwner(provider, "default", []metav1.OwnerReference{controllerRef("Job", "backup-28000000")}, nil, nil, nil)
+	require.NotNil(t, top)
+	assert.Equal(t, "CronJob", top.Kind)
+
+	// The chain stops at the owner which cannot be looked up
+	top = resolveTopOwner(provider, "default", []metav1.OwnerReference{controllerRef("StatefulSet", "redis")}, nil, nil, nil)
+	require.NotNil(t, top)
+	assert.Equal(t, "StatefulSet", top.Kind)
+
+	// Owners which are not controllers are not followed
+	assert.Nil(t, resolveTopOwner(provider, "default", []metav1.OwnerReference{{Kind: "Node", Name: "node-1"}}, nil, nil, nil))
+	assert.Nil(t, resolveTopOwner(provider, "default", nil, nil, nil, nil))
+}
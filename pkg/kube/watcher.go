@@ -2,6 +2,7 @@ package kube
 
 import (
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
@@ -9,9 +10,12 @@ import (
 	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
@@ -31,6 +35,11 @@ type eventWatcher struct {
 	wg                  sync.WaitGroup
 	maxEventAgeSeconds  time.Duration
 	omitLookup          bool
+	resolveOwners       bool
+
+	// namespaceInformer and namespaces are nil unless the namespace metadata is enabled
+	namespaceInformer cache.SharedIndexInformer
+	namespaces        listersv1.NamespaceLister
 }
 
 func NewEventWatcher(config *rest.Config, required *eventWatcherRequired, opts ...EventWatcherOption) (*eventWatcher, error) {
@@ -52,6 +61,7 @@ func NewEventWatcher(config *rest.Config, required *eventWatcherRequired, opts .
 		stopper:             make(chan struct{}),
 		objectMetadataCache: newObjectMetadataProviderWithTTL(o.cacheSize, o.mappingCacheSize, o.cacheTTL),
 		omitLookup:          o.omitLookup,
+		resolveOwners:       o.resolveOwners,
 		fn:                  o.onEvent,
 		maxEventAgeSeconds:  time.Second * time.Duration(o.maxEventAgeSeconds),
 		metricsStore:        o.metricsStore,
@@ -59,6 +69,18 @@ func NewEventWatcher(config *rest.Config, required *eventWatcherRequired, opts .
 		clientset:           clientset,
 	}
 
+	if o.namespaceMetadata {
+		// A watcher restricted to a namespace only needs that namespace
+		nsFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			if o.namespace != "" {
+				opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", o.namespace).String()
+			}
+		}))
+		namespaces := nsFactory.Core().V1().Namespaces()
+		watcher.namespaceInformer = namespaces.Informer()
+		watcher.namespaces = namespaces.Lister()
+	}
+
 	// Register watcher as ResourceEventHandler to process adds, updates, deletes
 	_, err := informer.AddEventHandler(watcher)
 	if err != nil {
@@ -91,15 +113,7 @@ func (e *eventWatcher) OnUpdate(oldObj, newObj any) {
 
 // Ignore events older than the maxEventAgeSeconds
 func (e *eventWatcher) isEventDiscarded(event *corev1.Event) bool {
-	// Use the most recent timestamp: series, then LastTimestamp, then EventTime
-	var timestamp time.Time
-	if event.Series != nil && !event.Series.LastObservedTime.Time.IsZero() {
-		timestamp = event.Series.LastObservedTime.Time
-	} else if !event.LastTimestamp.Time.IsZero() {
-		timestamp = event.LastTimestamp.Time
-	} else {
-		timestamp = event.EventTime.Time
-	}
+	timestamp := lastObserved(event)
 	eventAge := time.Since(timestamp)
 	if eventAge > e.maxEventAgeSeconds {
 		// Log discarded events if they were created after the watcher started
@@ -154,6 +168,20 @@ func (e *eventWatcher) onEvent(event *corev1.Event) {
 			ev.InvolvedObject.OwnerReferences = om.OwnerReferences
 			ev.InvolvedObject.ObjectReference = *event.InvolvedObject.DeepCopy()
 			ev.InvolvedObject.Deleted = om.Deleted
+			if e.resolveOwners {
+				ev.InvolvedObject.TopOwner = resolveTopOwner(e.objectMetadataCache, event.InvolvedObject.Namespace, om.OwnerReferences, e.clientset, e.dynamicClient, e.metricsStore)
+			}
+		}
+	}
+
+	if e.namespaces != nil && event.Namespace != "" {
+		ns, err := e.namespaces.Get(event.Namespace)
+		if err != nil {
+			log.Debug().Err(err).Str("namespace", event.Namespace).Msg("Cannot get namespace metadata")
+		} else {
+			// The namespace is shared by the informer cache, so the event gets its own maps
+			ev.NamespaceLabels = maps.Clone(ns.Labels)
+			ev.NamespaceAnnotations = maps.Clone(ns.Annotations)
 		}
 	}
 
@@ -165,7 +193,16 @@ func (e *eventWatcher) OnDelete(obj any) {
 }
 
 func (e *eventWatcher) Start() {
+	if e.namespaceInformer != nil {
+		e.wg.Go(func() {
+			e.namespaceInformer.Run(e.stopper)
+		})
+	}
 	e.wg.Go(func() {
+		// The namespaces are listed before the events, so that the first events get their metadata too
+		if e.namespaceInformer != nil && !cache.WaitForCacheSync(e.stopper, e.namespaceInformer.HasSynced) {
+			return
+		}
 		e.informer.Run(e.stopper)
 	})
 }
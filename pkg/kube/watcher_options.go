@@ -31,6 +31,8 @@ type eventWatcherRequired struct {
 	mappingCacheSize   int
 	cacheTTL           time.Duration
 	omitLookup         bool
+	resolveOwners      bool
+	namespaceMetadata  bool
 }
 
 // WithMetricsStore sets the MetricsStore for the EventWatcher
@@ -115,6 +117,24 @@ func WithOmitLookup(omit bool) EventWatcherOption {
 	}
 }
 
+// WithResolveOwners sets whether to resolve the top owner of the involved objects, it has no effect when lookups
+// are omitted
+func WithResolveOwners(resolve bool) EventWatcherOption {
+	return func(o *eventWatcherConfig) error {
+		o.resolveOwners = resolve
+		return nil
+	}
+}
+
+// WithNamespaceMetadata sets whether to keep an informer of the namespaces, to add their labels and annotations to
+// the events
+func WithNamespaceMetadata(enabled bool) EventWatcherOption {
+	return func(o *eventWatcherConfig) error {
+		o.namespaceMetadata = enabled
+		return nil
+	}
+}
+
 // NewEventWatcherRequired constructs an EventWatcherRequired instance using the provided options
 // It returns an error if any required options are missing or invalid
 func NewEventWatcherRequired(opts ...EventWatcherOption) (*eventWatcherRequired, error) {
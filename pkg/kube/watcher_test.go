@@ -18,6 +18,8 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 type mockObjectMetadataProvider struct {
@@ -356,6 +358,47 @@ func TestOnEvent_WithObjectMetadata(t *testing.T) {
 	}, event.InvolvedObject.OwnerReferences)
 }
 
+func TestOnEvent_WithNamespaceMetadata(t *testing.T) {
+	metricsStore := metrics.NewMetricsStore("test_")
+	defer metrics.DestroyMetricsStore(metricsStore)
+	ew := newMockEventWatcher(300, metricsStore)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "payments",
+		Labels:      map[string]string{"tier": "critical"},
+		Annotations: map[string]string{"owner": "team-payments"},
+	}}))
+	ew.namespaces = listersv1.NewNamespaceLister(indexer)
+
+	var event *EnhancedEvent
+	ew.fn = func(e *EnhancedEvent) {
+		event = e
+	}
+
+	startup := time.Now().Add(-10 * time.Minute)
+	ew.setStartUpTime(startup)
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "event1", Namespace: "payments"},
+		LastTimestamp:  metav1.Time{Time: startup.Add(8 * time.Minute)},
+		InvolvedObject: corev1.ObjectReference{UID: "test", Name: "test-1", Namespace: "payments"},
+	})
+	require.NotNil(t, event)
+	assert.Equal(t, map[string]string{"tier": "critical"}, event.NamespaceLabels)
+	assert.Equal(t, map[string]string{"owner": "team-payments"}, event.NamespaceAnnotations)
+
+	// An unknown namespace leaves the metadata empty
+	event = nil
+	ew.onEvent(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "event2", Namespace: "unknown"},
+		LastTimestamp:  metav1.Time{Time: startup.Add(8 * time.Minute)},
+		InvolvedObject: corev1.ObjectReference{UID: "test", Name: "test-2", Namespace: "unknown"},
+	})
+	require.NotNil(t, event)
+	assert.Nil(t, event.NamespaceLabels)
+	assert.Nil(t, event.NamespaceAnnotations)
+}
+
 func TestOnEvent_DeletedObjects(t *testing.T) {
 	metricsStore := metrics.NewMetricsStore("test_")
 	defer metrics.DestroyMetricsStore(metricsStore)
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/version"
@@ -25,6 +26,21 @@ type Store struct {
 	KubeApiMappingCacheHits    prometheus.Counter
 	KubeApiReadRequests        prometheus.Counter
 	KubeApiMappingReadRequests prometheus.Counter
+	SpoolDepth                 *prometheus.GaugeVec
+	QueueDepth                 *prometheus.GaugeVec
+	EventsDropped              *prometheus.CounterVec
+	SendRetries                *prometheus.CounterVec
+	CircuitBreakerState        *prometheus.GaugeVec
+	SendRateLimited            *prometheus.CounterVec
+	EventsUnflushed            *prometheus.CounterVec
+	BatchFlushes               *prometheus.CounterVec
+	BatchSize                  *prometheus.HistogramVec
+	BatchRetries               *prometheus.CounterVec
+	BatchDropped               *prometheus.CounterVec
+	ConfigReloads              *prometheus.CounterVec
+	EventsSuppressed           *prometheus.CounterVec
+	DedupReminders             *prometheus.CounterVec
+	EventsSilenced             *prometheus.CounterVec
 }
 
 // parseLogLevel parses a textual log level and returns a slog.Level.
@@ -80,10 +96,7 @@ func Init(addr, tlsConf, logLevel string) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "OK")
 	})
-	http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
-	})
+	http.HandleFunc("/-/ready", readyHandler)
 
 	metricsServer := http.Server{
 		ReadHeaderTimeout: 5 * time.Second}
@@ -102,6 +115,33 @@ func Init(addr, tlsConf, logLevel string) {
 	}()
 }
 
+// readinessChecks are run by the /-/ready endpoint, the exporter is ready when none of them returns an error
+var readinessChecks struct {
+	checks []func() error
+	mu     sync.RWMutex
+}
+
+// AddReadinessCheck registers a check which makes the /-/ready endpoint report not ready while it returns an error
+func AddReadinessCheck(check func() error) {
+	readinessChecks.mu.Lock()
+	defer readinessChecks.mu.Unlock()
+	readinessChecks.checks = append(readinessChecks.checks, check)
+}
+
+func readyHandler(w http.ResponseWriter, _ *http.Request) {
+	readinessChecks.mu.RLock()
+	defer readinessChecks.mu.RUnlock()
+	for _, check := range readinessChecks.checks {
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "Not ready: %s", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "OK")
+}
+
 func NewMetricsStore(name_prefix string) *Store {
 	return &Store{
 		BuildInfo: promauto.NewGaugeFunc(
@@ -150,6 +190,67 @@ func NewMetricsStore(name_prefix string) *Store {
 			Name: name_prefix + "kube_api_mapping_cache_misses",
 			Help: "The total number of read requests served from kube-apiserver when looking up object metadata mapping",
 		}),
+		SpoolDepth: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name_prefix + "receiver_spool_depth",
+			Help: "The number of events in the receiver spool which are not acknowledged by the sink yet",
+		}, []string{"receiver"}),
+		QueueDepth: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name_prefix + "receiver_queue_depth",
+			Help: "The number of events waiting in the receiver queue",
+		}, []string{"receiver"}),
+		EventsDropped: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_events_dropped",
+			Help: "The total number of events dropped because the receiver queue was full or they could not be delivered",
+		}, []string{"receiver"}),
+		SendRetries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_send_retries",
+			Help: "The total number of attempts to send an event to a receiver again after a retryable error",
+		}, []string{"receiver"}),
+		CircuitBreakerState: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name_prefix + "receiver_circuit_breaker_state",
+			Help: "The state of the receiver circuit breaker: 0 closed, 1 half-open, 2 open",
+		}, []string{"receiver"}),
+		SendRateLimited: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_send_rate_limited",
+			Help: "The total number of sends which the receiver rejected because of rate limiting",
+		}, []string{"receiver"}),
+		EventsUnflushed: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_events_unflushed",
+			Help: "The total number of events which were not delivered before the shutdown timeout",
+		}, []string{"receiver"}),
+		BatchFlushes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_batch_flushes",
+			Help: "The total number of batches handed to the destination by the batch writer of a receiver",
+		}, []string{"receiver"}),
+		BatchSize: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    name_prefix + "receiver_batch_size",
+			Help:    "The number of items of the batches handed to the destination by the batch writer of a receiver",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 7),
+		}, []string{"receiver"}),
+		BatchRetries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_batch_retries",
+			Help: "The total number of failed items queued for a retry by the batch writer of a receiver",
+		}, []string{"receiver"}),
+		BatchDropped: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "receiver_batch_dropped",
+			Help: "The total number of items dropped by the batch writer of a receiver, labeled by reason",
+		}, []string{"receiver", "reason"}),
+		ConfigReloads: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "config_reloads",
+			Help: "The total number of configuration reloads, labeled by result: success or failure",
+		}, []string{"result"}),
+		EventsSuppressed: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "events_suppressed",
+			Help: "The total number of repeated events suppressed by deduplication, labeled by the receiver or route deduplicating them",
+		}, []string{"dedup"}),
+		DedupReminders: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "dedup_reminders",
+			Help: "The total number of reminders sent for suppressed repeated events, labeled by the receiver or route deduplicating them",
+		}, []string{"dedup"}),
+		EventsSilenced: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: name_prefix + "events_silenced",
+			Help: "The total number of events muted by a silence, labeled by the id of a configured silence or api for the silences created at runtime",
+		}, []string{"silence"}),
 	}
 }
 
@@ -163,5 +264,20 @@ func DestroyMetricsStore(store *Store) {
 	prometheus.Unregister(store.KubeApiReadRequests)
 	prometheus.Unregister(store.KubeApiMappingCacheHits)
 	prometheus.Unregister(store.KubeApiMappingReadRequests)
+	prometheus.Unregister(store.SpoolDepth)
+	prometheus.Unregister(store.QueueDepth)
+	prometheus.Unregister(store.EventsDropped)
+	prometheus.Unregister(store.SendRetries)
+	prometheus.Unregister(store.CircuitBreakerState)
+	prometheus.Unregister(store.SendRateLimited)
+	prometheus.Unregister(store.EventsUnflushed)
+	prometheus.Unregister(store.BatchFlushes)
+	prometheus.Unregister(store.BatchSize)
+	prometheus.Unregister(store.BatchRetries)
+	prometheus.Unregister(store.BatchDropped)
+	prometheus.Unregister(store.ConfigReloads)
+	prometheus.Unregister(store.EventsSuppressed)
+	prometheus.Unregister(store.DedupReminders)
+	prometheus.Unregister(store.EventsSilenced)
 	store = nil
 }
@@ -1,7 +1,11 @@
 package metrics
 
 import (
+	"errors"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +31,24 @@ func TestParseLogLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestReadyHandler(t *testing.T) {
+	var failing error
+	AddReadinessCheck(func() error { return failing })
+
+	rec := httptest.NewRecorder()
+	readyHandler(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("readyHandler status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	failing = errors.New("circuit breaker open for receiver \"elasticsearch\"")
+	rec = httptest.NewRecorder()
+	readyHandler(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyHandler status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(rec.Body.String(), "elasticsearch") {
+		t.Fatalf("readyHandler body = %q, want the failing check", rec.Body.String())
+	}
+}
@@ -0,0 +1,117 @@
+package setup
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/exporter"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// LoadConfig reads the config file, expands the environment variables in it, then parses, defaults and validates
+// the config
+func LoadConfig(path string) (exporter.Config, error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return exporter.Config{}, fmt.Errorf("cannot read config file: %w", err)
+	}
+	return loadConfigFromBytes(configBytes)
+}
+
+func loadConfigFromBytes(configBytes []byte) (exporter.Config, error) {
+	cfg, err := ParseConfigFromBytes([]byte(os.ExpandEnv(string(configBytes))))
+	if err != nil {
+		return exporter.Config{}, err
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return exporter.Config{}, fmt.Errorf("config validation failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// Reloader applies a new config, it is implemented by exporter.Engine
+type Reloader interface {
+	Reload(*exporter.Config) error
+}
+
+// ConfigWatcher reloads the config file whenever its content changes, and on SIGHUP. An invalid config is rejected
+// and the current one keeps running.
+type ConfigWatcher struct {
+	Engine       Reloader
+	MetricsStore *metrics.Store
+	Path         string
+	// Interval is how often the file is checked for changes, zero only reloads on SIGHUP
+	Interval time.Duration
+	checksum [sha256.Size]byte
+}
+
+// Run watches the config file until ctx is done
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	if b, err := os.ReadFile(w.Path); err == nil {
+		w.checksum = sha256.Sum256(b)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if w.Interval > 0 {
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info().Str("path", w.Path).Msg("Received SIGHUP, reloading config")
+			w.reload(true)
+		case <-tick:
+			w.reload(false)
+		}
+	}
+}
+
+// reload applies the config file if its content changed since the last reload, or unconditionally when forced. It
+// reports whether a new config was applied.
+func (w *ConfigWatcher) reload(force bool) bool {
+	configBytes, err := os.ReadFile(w.Path)
+	if err != nil {
+		w.failed(fmt.Errorf("cannot read config file: %w", err))
+		return false
+	}
+	checksum := sha256.Sum256(configBytes)
+	if !force && checksum == w.checksum {
+		return false
+	}
+	// A broken file is reported once, not on every check
+	w.checksum = checksum
+
+	cfg, err := loadConfigFromBytes(configBytes)
+	if err != nil {
+		w.failed(err)
+		return false
+	}
+	if err := w.Engine.Reload(&cfg); err != nil {
+		w.failed(err)
+		return false
+	}
+	w.MetricsStore.ConfigReloads.WithLabelValues("success").Inc()
+	log.Info().Str("path", w.Path).Msg("Config reloaded")
+	return true
+}
+
+func (w *ConfigWatcher) failed(err error) {
+	w.MetricsStore.ConfigReloads.WithLabelValues("failure").Inc()
+	log.Error().Err(err).Str("path", w.Path).Msg("Cannot reload config, keeping the current one")
+}
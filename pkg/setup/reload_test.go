@@ -0,0 +1,95 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/exporter"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingReloader records the configs it is given, and fails while err is set
+type recordingReloader struct {
+	err     error
+	configs []*exporter.Config
+}
+
+func (r *recordingReloader) Reload(cfg *exporter.Config) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.configs = append(r.configs, cfg)
+	return nil
+}
+
+func TestConfigWatcher_Reload(t *testing.T) {
+	store := metrics.NewMetricsStore(fmt.Sprintf("%s_%d_", t.Name(), time.Now().UnixNano()))
+	defer metrics.DestroyMetricsStore(store)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	writeConfig(`
+receivers:
+  - name: "dump"
+    stdout: {}
+`)
+	engine := &recordingReloader{}
+	w := &ConfigWatcher{Engine: engine, MetricsStore: store, Path: path}
+
+	// The first check applies the config, as it was not seen yet
+	assert.True(t, w.reload(false))
+	// An unchanged file is only applied again when forced, like on SIGHUP
+	assert.False(t, w.reload(false))
+	assert.True(t, w.reload(true))
+	require.Len(t, engine.configs, 2)
+	assert.Equal(t, "dump", engine.configs[1].Receivers[0].Name)
+
+	// An invalid config is rejected and not applied
+	writeConfig(`
+receivers:
+  - name: "dump"
+    stdout: {}
+  - name: "dump"
+    stdout: {}
+`)
+	assert.False(t, w.reload(false))
+	engine.err = errors.New("cannot initialize sink")
+	writeConfig(`
+receivers:
+  - name: "other"
+    stdout: {}
+`)
+	assert.False(t, w.reload(false))
+	assert.Len(t, engine.configs, 2)
+
+	assert.InDelta(t, 2, testutil.ToFloat64(store.ConfigReloads.WithLabelValues("success")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(store.ConfigReloads.WithLabelValues("failure")), 0)
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("RECEIVER_NAME", "dump")
+	require.NoError(t, os.WriteFile(path, []byte(`
+receivers:
+  - name: "${RECEIVER_NAME}"
+    stdout: {}
+`), 0o600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", cfg.Receivers[0].Name)
+	assert.Equal(t, int64(5), cfg.MaxEventAgeSeconds)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
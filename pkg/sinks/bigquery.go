@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/batch"
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/option"
 	"math/rand"
@@ -61,7 +62,7 @@ func bigQuerySanitizeKeys(x map[string]any) map[string]any {
 	return y
 }
 
-func bigQueryWriteBatchToJsonFile(items []any, path string) error {
+func bigQueryWriteBatchToJsonFile(items []*kube.EnhancedEvent, path string) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -70,9 +71,8 @@ func bigQueryWriteBatchToJsonFile(items []any, path string) error {
 
 	writer := bufio.NewWriter(file)
 	for i := range items {
-		event := items[i].(*kube.EnhancedEvent)
 		var mapStruct map[string]any
-		json.Unmarshal(event.ToJSON(), &mapStruct)
+		json.Unmarshal(items[i].ToJSON(), &mapStruct)
 		jsonBytes, _ := json.Marshal(bigQuerySanitizeKeys(bigQueryDropNils(mapStruct)))
 		fmt.Fprintln(writer, string(jsonBytes))
 	}
@@ -95,8 +95,7 @@ func bigQueryCreateDataset(cfg *BigQueryConfig) error {
 	return nil
 }
 
-func bigQueryImportJsonFromFile(path string, cfg *BigQueryConfig) error {
-	ctx := context.Background()
+func bigQueryImportJsonFromFile(ctx context.Context, path string, cfg *BigQueryConfig) error {
 	client, err := bigquery.NewClient(ctx, cfg.Project, option.WithCredentialsFile(cfg.CredentialsPath))
 	if err != nil {
 		return fmt.Errorf("bigquery.NewClient: %v", err)
@@ -182,7 +181,7 @@ func NewBigQuerySink(cfg *BigQueryConfig) (*BigQuerySink, error) {
 	}
 
 	rand.Seed(time.Now().UTC().UnixNano())
-	handleBatch := func(ctx context.Context, items []any) []bool {
+	handleBatch := func(ctx context.Context, items []*kube.EnhancedEvent) []bool {
 		res := make([]bool, len(items))
 		for i := range items {
 			res[i] = true
@@ -191,7 +190,7 @@ func NewBigQuerySink(cfg *BigQueryConfig) (*BigQuerySink, error) {
 		if err := bigQueryWriteBatchToJsonFile(items, path); err != nil {
 			log.Error().Msgf("Failed to write JSON file: %v", err)
 		}
-		if err := bigQueryImportJsonFromFile(path, cfg); err != nil {
+		if err := bigQueryImportJsonFromFile(ctx, path, cfg); err != nil {
 			log.Error().Msgf("BigQuerySink load failed: %v", err)
 		} else {
 			// The batch file is intentionally not deleted in case of failure allowing to manually uplaod it later and debug issues.
@@ -221,12 +220,25 @@ func NewBigQuerySink(cfg *BigQueryConfig) (*BigQuerySink, error) {
 }
 
 type BigQuerySink struct {
-	batchWriter *batch.Writer
+	batchWriter *batch.Writer[*kube.EnhancedEvent]
 }
 
+// Send buffers the event for the next batch. A full batch writer is reported as a retryable error, so the
+// receiver backs off instead of losing the event.
 func (e *BigQuerySink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
-	e.batchWriter.Submit(ev)
-	return nil
+	err := e.batchWriter.Submit(ev)
+	if errors.Is(err, batch.ErrQueueFull) {
+		return Retryable(err, 0)
+	}
+	return err
+}
+
+func (e *BigQuerySink) SetMetricsStore(store *metrics.Store, receiver string) {
+	e.batchWriter.SetMetrics(store, receiver)
+}
+
+func (e *BigQuerySink) Flush(ctx context.Context) int {
+	return e.batchWriter.Flush(ctx)
 }
 
 func (e *BigQuerySink) Close() {
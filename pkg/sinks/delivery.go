@@ -0,0 +1,281 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+)
+
+// Overflow policies of a receiver queue
+const (
+	// OverflowBlock makes the producer wait until there is room in the queue
+	OverflowBlock = "block"
+	// OverflowDropNewest drops the incoming event
+	OverflowDropNewest = "dropNewest"
+	// OverflowDropOldest drops the event which has been waiting the longest
+	OverflowDropOldest = "dropOldest"
+	// OverflowDropNormal drops Normal events first: an incoming Warning evicts the oldest queued Normal event
+	OverflowDropNormal = "dropNormal"
+
+	DefaultQueueSize = 1024
+
+	DefaultRetryMaxAttempts = 5
+	DefaultRetryBaseBackoff = 500 * time.Millisecond
+	DefaultRetryMaxBackoff  = 30 * time.Second
+	DefaultRetryJitter      = 0.2
+
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerSuccessThreshold = 1
+	DefaultBreakerProbeInterval    = 30 * time.Second
+
+	DefaultBatchSize       = 100
+	DefaultBatchMaxLatency = time.Second
+
+	DefaultDedupWindow = 5 * time.Minute
+
+	DefaultGroupWait      = 30 * time.Second
+	DefaultGroupInterval  = 5 * time.Minute
+	DefaultRepeatInterval = 4 * time.Hour
+	DefaultResolveTimeout = 5 * time.Minute
+	DefaultGroupMaxEvents = 100
+)
+
+// DefaultDedupFields identify the repeats of an event about the same object by default
+var DefaultDedupFields = []string{"namespace", "involvedObject.kind", "involvedObject.name", "reason"}
+
+// QueueConfig bounds the number of events waiting to be sent to a receiver and decides what happens when it is full
+type QueueConfig struct {
+	Overflow string `yaml:"overflow"`
+	Size     int    `yaml:"size"`
+}
+
+func (q *QueueConfig) SetDefaults() {
+	if q.Size == 0 {
+		q.Size = DefaultQueueSize
+	}
+	if q.Overflow == "" {
+		q.Overflow = OverflowBlock
+	}
+}
+
+func (q *QueueConfig) Validate() error {
+	if q.Size < 0 {
+		return fmt.Errorf("queue.size must not be negative, got %d", q.Size)
+	}
+	switch q.Overflow {
+	case "", OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowDropNormal:
+		return nil
+	default:
+		return fmt.Errorf("queue.overflow must be one of %s, %s, %s or %s, got %q",
+			OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowDropNormal, q.Overflow)
+	}
+}
+
+// RetryConfig controls how often and how fast sending an event to a receiver is attempted again after a
+// retryable error. Errors marked as permanent by the sink are never retried.
+type RetryConfig struct {
+	// MaxAttempts includes the first attempt
+	MaxAttempts int           `yaml:"maxAttempts"`
+	BaseBackoff time.Duration `yaml:"baseBackoff"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff"`
+	// Jitter is the fraction of the backoff which is randomized, between 0 and 1
+	Jitter float64 `yaml:"jitter"`
+	// Deadline bounds the total time spent delivering a single event, zero means no limit
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+func (c *RetryConfig) SetDefaults() {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if c.BaseBackoff == 0 {
+		c.BaseBackoff = DefaultRetryBaseBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = max(DefaultRetryMaxBackoff, c.BaseBackoff)
+	}
+	if c.Jitter == 0 {
+		c.Jitter = DefaultRetryJitter
+	}
+}
+
+func (c *RetryConfig) Validate() error {
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("retry.maxAttempts must not be negative, got %d", c.MaxAttempts)
+	}
+	if c.BaseBackoff < 0 || c.MaxBackoff < 0 || c.Deadline < 0 {
+		return errors.New("retry durations must not be negative")
+	}
+	if c.MaxBackoff != 0 && c.MaxBackoff < c.BaseBackoff {
+		return fmt.Errorf("retry.maxBackoff (%s) must not be less than retry.baseBackoff (%s)", c.MaxBackoff, c.BaseBackoff)
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("retry.jitter must be between 0 and 1, got %v", c.Jitter)
+	}
+	return nil
+}
+
+// CircuitBreakerConfig stops calling a sink after consecutive failures. Once the probe interval passed, a single
+// event is sent to probe whether the sink recovered.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive retryable errors which open the circuit
+	FailureThreshold int `yaml:"failureThreshold"`
+	// SuccessThreshold is the number of consecutive successful probes which close the circuit again
+	SuccessThreshold int           `yaml:"successThreshold"`
+	ProbeInterval    time.Duration `yaml:"probeInterval"`
+}
+
+func (c *CircuitBreakerConfig) SetDefaults() {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if c.SuccessThreshold == 0 {
+		c.SuccessThreshold = DefaultBreakerSuccessThreshold
+	}
+	if c.ProbeInterval == 0 {
+		c.ProbeInterval = DefaultBreakerProbeInterval
+	}
+}
+
+func (c *CircuitBreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 || c.SuccessThreshold < 0 {
+		return fmt.Errorf("circuitBreaker thresholds must not be negative, got %d and %d", c.FailureThreshold, c.SuccessThreshold)
+	}
+	if c.ProbeInterval < 0 {
+		return fmt.Errorf("circuitBreaker.probeInterval must not be negative, got %s", c.ProbeInterval)
+	}
+	return nil
+}
+
+// RateLimitConfig limits how many events per second are sent to a receiver, with a token bucket of burst events
+type RateLimitConfig struct {
+	EventsPerSecond float64 `yaml:"eventsPerSecond"`
+	Burst           int     `yaml:"burst"`
+}
+
+func (c *RateLimitConfig) SetDefaults() {
+	if c.Burst == 0 {
+		c.Burst = max(int(math.Ceil(c.EventsPerSecond)), 1)
+	}
+}
+
+func (c *RateLimitConfig) Validate() error {
+	if c.EventsPerSecond <= 0 {
+		return fmt.Errorf("rateLimit.eventsPerSecond must be positive, got %v", c.EventsPerSecond)
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("rateLimit.burst must not be negative, got %d", c.Burst)
+	}
+	return nil
+}
+
+// BatchConfig gathers the events of a receiver into batches for sinks which can send them at once. A batch is sent
+// when it holds size events, or when its first event waited for maxLatency.
+type BatchConfig struct {
+	Size       int           `yaml:"size"`
+	MaxLatency time.Duration `yaml:"maxLatency"`
+}
+
+func (c *BatchConfig) SetDefaults() {
+	if c.Size == 0 {
+		c.Size = DefaultBatchSize
+	}
+	if c.MaxLatency == 0 {
+		c.MaxLatency = DefaultBatchMaxLatency
+	}
+}
+
+func (c *BatchConfig) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("batch.size must not be negative, got %d", c.Size)
+	}
+	if c.MaxLatency < 0 {
+		return fmt.Errorf("batch.maxLatency must not be negative, got %s", c.MaxLatency)
+	}
+	return nil
+}
+
+// DedupConfig suppresses the events which repeat an event with the same fingerprint within the window. The
+// fingerprint is made of the values of the fields, named like in the JSON form of the event, e.g.
+// "involvedObject.labels.app". Every repeat extends the window. When repeatInterval is set, a reminder carrying
+// the number of suppressed repeats is sent at most that often while the repeats go on.
+type DedupConfig struct {
+	Fields         []string      `yaml:"fields"`
+	Window         time.Duration `yaml:"window"`
+	RepeatInterval time.Duration `yaml:"repeatInterval"`
+}
+
+func (c *DedupConfig) SetDefaults() {
+	if len(c.Fields) == 0 {
+		c.Fields = slices.Clone(DefaultDedupFields)
+	}
+	if c.Window == 0 {
+		c.Window = DefaultDedupWindow
+	}
+}
+
+func (c *DedupConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("dedup.window must not be negative, got %s", c.Window)
+	}
+	if c.RepeatInterval < 0 {
+		return fmt.Errorf("dedup.repeatInterval must not be negative, got %s", c.RepeatInterval)
+	}
+	for _, field := range c.Fields {
+		if _, err := kube.CompileField(field); err != nil {
+			return fmt.Errorf("dedup.fields: %w", err)
+		}
+	}
+	return nil
+}
+
+// GroupConfig gathers the events which share the values of the by fields into groups, and sends a single
+// notification listing the events of a group instead of one per event. The first notification of a group is sent
+// groupWait after its first event, further ones every groupInterval if events joined the group meanwhile, or every
+// repeatInterval otherwise. An event leaves its group once it was not updated for resolveTimeout, and a group without
+// events is forgotten. A notification lists at most maxEvents events, the others are only counted.
+type GroupConfig struct {
+	By             []string      `yaml:"by"`
+	GroupWait      time.Duration `yaml:"groupWait"`
+	GroupInterval  time.Duration `yaml:"groupInterval"`
+	RepeatInterval time.Duration `yaml:"repeatInterval"`
+	ResolveTimeout time.Duration `yaml:"resolveTimeout"`
+	MaxEvents      int           `yaml:"maxEvents"`
+}
+
+func (c *GroupConfig) SetDefaults() {
+	if c.GroupWait == 0 {
+		c.GroupWait = DefaultGroupWait
+	}
+	if c.GroupInterval == 0 {
+		c.GroupInterval = DefaultGroupInterval
+	}
+	if c.RepeatInterval == 0 {
+		c.RepeatInterval = DefaultRepeatInterval
+	}
+	if c.ResolveTimeout == 0 {
+		c.ResolveTimeout = DefaultResolveTimeout
+	}
+	if c.MaxEvents == 0 {
+		c.MaxEvents = DefaultGroupMaxEvents
+	}
+}
+
+func (c *GroupConfig) Validate() error {
+	if c.GroupWait < 0 || c.GroupInterval < 0 || c.RepeatInterval < 0 || c.ResolveTimeout < 0 {
+		return errors.New("group durations must not be negative")
+	}
+	if c.MaxEvents < 0 {
+		return fmt.Errorf("group.maxEvents must not be negative, got %d", c.MaxEvents)
+	}
+	for _, field := range c.By {
+		if _, err := kube.CompileField(field); err != nil {
+			return fmt.Errorf("group.by: %w", err)
+		}
+	}
+	return nil
+}
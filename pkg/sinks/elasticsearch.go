@@ -14,7 +14,6 @@ import (
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
-	"github.com/rs/zerolog/log"
 )
 
 type ElasticsearchConfig struct {
@@ -97,37 +96,14 @@ func formatIndexName(pattern string, when time.Time) string {
 }
 
 func (e *Elasticsearch) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
-	var toSend []byte
-
-	if e.cfg.DeDot {
-		de := ev.DeDot()
-		ev = &de
-	}
-	if e.cfg.Layout != nil {
-		res, err := convertLayoutTemplate(e.cfg.Layout, ev)
-		if err != nil {
-			return err
-		}
-
-		toSend, err = json.Marshal(res)
-		if err != nil {
-			return err
-		}
-	} else {
-		toSend = ev.ToJSON()
-	}
-
-	var index string
-	if len(e.cfg.IndexFormat) > 0 {
-		now := time.Now()
-		index = formatIndexName(e.cfg.IndexFormat, now)
-	} else {
-		index = e.cfg.Index
+	toSend, err := e.document(ev)
+	if err != nil {
+		return err
 	}
 
 	req := esapi.IndexRequest{
 		Body:  bytes.NewBuffer(toSend),
-		Index: index,
+		Index: e.index(),
 	}
 
 	// This should not be used for clusters with ES8.0+.
@@ -150,11 +126,124 @@ func (e *Elasticsearch) Send(ctx context.Context, ev *kube.EnhancedEvent) error
 		if err != nil {
 			return err
 		}
-		log.Error().Msgf("Indexing failed: %s", string(rb))
+		return NewHTTPError(resp.StatusCode, resp.Header, rb)
 	}
 	return nil
 }
 
+// elasticsearchMaxBatchSize bounds the number of documents of a bulk request
+const elasticsearchMaxBatchSize = 1000
+
+// bulkResponse is the part of the bulk API response describing the result of every action
+type bulkResponse struct {
+	Items []map[string]struct {
+		Error  json.RawMessage `json:"error"`
+		Status int             `json:"status"`
+	} `json:"items"`
+	Errors bool `json:"errors"`
+}
+
+// SendBatch indexes the events with the bulk API. Every document gets the error of its own action, classified by
+// its status code like the response of a single index request.
+func (e *Elasticsearch) SendBatch(ctx context.Context, evs []*kube.EnhancedEvent) []error {
+	return sendChunks(evs, elasticsearchMaxBatchSize, func(chunk []*kube.EnhancedEvent) []error {
+		errs := make([]error, len(chunk))
+		index := e.index()
+		var body bytes.Buffer
+		// sent maps the actions to their event, as the events which cannot be serialized are not sent
+		sent := make([]int, 0, len(chunk))
+		for i, ev := range chunk {
+			doc, err := e.document(ev)
+			if err != nil {
+				errs[i] = Permanent(err)
+				continue
+			}
+			action := map[string]string{"_index": index}
+			if len(e.cfg.Type) > 0 {
+				action["_type"] = e.cfg.Type
+			}
+			if e.cfg.UseEventID {
+				action["_id"] = string(ev.UID)
+			}
+			meta, err := json.Marshal(map[string]any{"index": action})
+			if err != nil {
+				errs[i] = Permanent(err)
+				continue
+			}
+			body.Write(meta)
+			body.WriteByte('\n')
+			body.Write(doc)
+			body.WriteByte('\n')
+			sent = append(sent, i)
+		}
+		if len(sent) == 0 {
+			return errs
+		}
+
+		setAll := func(err error) []error {
+			for _, i := range sent {
+				errs[i] = err
+			}
+			return errs
+		}
+		resp, err := esapi.BulkRequest{Body: &body}.Do(ctx, e.client)
+		if err != nil {
+			return setAll(err)
+		}
+		defer resp.Body.Close()
+		rb, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return setAll(err)
+		}
+		if resp.StatusCode > 399 {
+			return setAll(NewHTTPError(resp.StatusCode, resp.Header, rb))
+		}
+
+		var res bulkResponse
+		if err := json.Unmarshal(rb, &res); err != nil {
+			return setAll(fmt.Errorf("cannot decode bulk response: %w", err))
+		}
+		if !res.Errors {
+			return errs
+		}
+		for j, item := range res.Items {
+			if j >= len(sent) {
+				break
+			}
+			for _, result := range item {
+				if result.Status > 399 {
+					errs[sent[j]] = NewHTTPError(result.Status, nil, result.Error)
+				}
+			}
+		}
+		return errs
+	})
+}
+
+// document renders the event to index, with the layout if any
+func (e *Elasticsearch) document(ev *kube.EnhancedEvent) ([]byte, error) {
+	if e.cfg.DeDot {
+		de := ev.DeDot()
+		ev = &de
+	}
+	if e.cfg.Layout != nil {
+		res, err := convertLayoutTemplate(e.cfg.Layout, ev)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(res)
+	}
+	return ev.ToJSON(), nil
+}
+
+// index returns the name of the index to write to now
+func (e *Elasticsearch) index() string {
+	if len(e.cfg.IndexFormat) > 0 {
+		return formatIndexName(e.cfg.IndexFormat, time.Now())
+	}
+	return e.cfg.Index
+}
+
 func (e *Elasticsearch) Close() {
 	// No-op
 }
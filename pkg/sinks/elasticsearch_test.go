@@ -0,0 +1,59 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestElasticsearchSendBatchUsesBulkAPI(t *testing.T) {
+	var actions []map[string]map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			// The client checks the product before the first request
+			_, _ = w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+			return
+		}
+		require.Equal(t, "/_bulk", r.URL.Path)
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+			actions = append(actions, action)
+			require.True(t, scanner.Scan(), "every action is followed by a document")
+		}
+		_, _ = w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"status":201}},` +
+			`{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}},` +
+			`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewElasticsearch(&ElasticsearchConfig{Hosts: []string{server.URL}, Index: "kube-events", UseEventID: true})
+	require.NoError(t, err)
+
+	evs := []*kube.EnhancedEvent{
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-1"}}},
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-2"}}},
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-3"}}},
+	}
+	errs := sink.SendBatch(context.Background(), evs)
+
+	require.Len(t, actions, 3)
+	require.Equal(t, map[string]string{"_index": "kube-events", "_id": "uid-2"}, actions[1]["index"])
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.True(t, IsPermanent(errs[1]))
+	require.True(t, IsRateLimited(errs[2]))
+}
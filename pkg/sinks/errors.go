@@ -0,0 +1,103 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SendError classifies why a sink could not deliver an event, so that the registry can decide whether another
+// attempt makes sense. Errors returned by sinks which are not a SendError are considered retryable.
+type SendError struct {
+	Err error
+	// RetryAfter is the minimum delay requested by the remote side before the next attempt, zero if not given
+	RetryAfter time.Duration
+	Permanent  bool
+	// RateLimited is set when the remote side throttles us, the registry then holds back all sends to the receiver
+	RateLimited bool
+}
+
+func (e *SendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not retryable, for example because the payload was rejected
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SendError{Err: err, Permanent: true}
+}
+
+// Retryable marks err as retryable after at least retryAfter
+func Retryable(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &SendError{Err: err, RetryAfter: retryAfter}
+}
+
+// RateLimited marks err as caused by the remote side throttling us. Sending is retryable after at least retryAfter,
+// zero if the remote side did not tell.
+func RateLimited(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &SendError{Err: err, RetryAfter: retryAfter, RateLimited: true}
+}
+
+// IsRateLimited reports whether err was marked as rate limited
+func IsRateLimited(err error) bool {
+	var se *SendError
+	return errors.As(err, &se) && se.RateLimited
+}
+
+// IsPermanent reports whether err was marked as permanent
+func IsPermanent(err error) bool {
+	var se *SendError
+	return errors.As(err, &se) && se.Permanent
+}
+
+// RetryAfter returns the delay requested by the remote side before the next attempt, zero if there is none
+func RetryAfter(err error) time.Duration {
+	var se *SendError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
+
+// NewHTTPError classifies an unsuccessful HTTP response. Request timeouts, rate limiting and server errors are
+// retryable and honor the Retry-After header, every other status means the request itself is wrong.
+// A 429 response is also marked as rate limited.
+func NewHTTPError(statusCode int, header http.Header, body []byte) error {
+	err := fmt.Errorf("not successful (2xx) response: %d %s", statusCode, strings.TrimSpace(string(body)))
+	if statusCode == http.StatusTooManyRequests {
+		return RateLimited(err, parseRetryAfter(header.Get("Retry-After")))
+	}
+	if statusCode == http.StatusRequestTimeout || statusCode >= 500 {
+		return Retryable(err, parseRetryAfter(header.Get("Retry-After")))
+	}
+	return Permanent(err)
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package sinks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		header      http.Header
+		permanent   bool
+		rateLimited bool
+		retryAfter  time.Duration
+	}{
+		{name: "bad request", status: http.StatusBadRequest, permanent: true},
+		{name: "not found", status: http.StatusNotFound, permanent: true},
+		{name: "request timeout", status: http.StatusRequestTimeout},
+		{name: "server error", status: http.StatusInternalServerError},
+		{
+			name:        "rate limited",
+			status:      http.StatusTooManyRequests,
+			header:      http.Header{"Retry-After": []string{"7"}},
+			rateLimited: true,
+			retryAfter:  7 * time.Second,
+		},
+		{
+			name:   "unavailable with invalid retry after",
+			status: http.StatusServiceUnavailable,
+			header: http.Header{"Retry-After": []string{"soon"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewHTTPError(tt.status, tt.header, []byte("body\n"))
+			assert.ErrorContains(t, err, fmt.Sprintf("%d body", tt.status))
+			assert.Equal(t, tt.permanent, IsPermanent(err))
+			assert.Equal(t, tt.rateLimited, IsRateLimited(err))
+			assert.Equal(t, tt.retryAfter, RetryAfter(err))
+		})
+	}
+}
+
+func TestSendError_Wrapped(t *testing.T) {
+	cause := errors.New("boom")
+	err := fmt.Errorf("sending: %w", Permanent(cause))
+
+	assert.True(t, IsPermanent(err))
+	assert.ErrorIs(t, err, cause)
+	assert.False(t, IsPermanent(cause))
+	assert.Nil(t, Permanent(nil))
+	assert.Equal(t, time.Second, RetryAfter(Retryable(cause, time.Second)))
+}
+
+func TestParseRetryAfter_HTTPDate(t *testing.T) {
+	when := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	d := parseRetryAfter(when)
+	assert.Greater(t, d, 50*time.Second)
+	assert.LessOrEqual(t, d, time.Minute)
+}
@@ -80,37 +80,129 @@ func newEventBridgeSinkWithClient(cfg *EventBridgeConfig, svc eventbridgeAPI) (S
 
 func (s *EventBridgeSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	log.Info().Msg("Sending event to EventBridge ")
+	inputRequest, err := s.entry(ev)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("InputEvent", aws.ToString(inputRequest.Detail)).Msg("Request")
+
+	_, err = s.svc.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: []eventbridgetypes.PutEventsRequestEntry{inputRequest}})
+	if err != nil {
+		log.Error().Err(err).Msg("EventBridge Error")
+		return err
+	}
+	return nil
+}
+
+const (
+	// eventBridgeMaxBatchSize is the maximum number of entries of a PutEvents request
+	eventBridgeMaxBatchSize = 10
+	// eventBridgeMaxBatchBytes is the maximum total size of the entries of a PutEvents request, and so of an entry
+	eventBridgeMaxBatchBytes = 256 * 1024
+	// eventBridgeTimeBytes is what the time of an entry counts against the size limit
+	eventBridgeTimeBytes = 14
+)
+
+// SendBatch puts the events with PutEvents, in requests which respect both the limits of the number of entries and of
+// their total size. Entries which are too large on their own are reported as permanent errors without being sent.
+// Throttled entries are reported as rate limited, entries failed because of an internal error as retryable and the
+// other failed entries as permanent.
+func (s *EventBridgeSink) SendBatch(ctx context.Context, evs []*kube.EnhancedEvent) []error {
+	log.Info().Int("events", len(evs)).Msg("Sending events to EventBridge")
+	errs := make([]error, len(evs))
+	entries := make([]eventbridgetypes.PutEventsRequestEntry, 0, min(len(evs), eventBridgeMaxBatchSize))
+	// index maps the entries to their event, as the events which cannot be serialized or are too large are not sent
+	index := make([]int, 0, cap(entries))
+	size := 0
+	for i, ev := range evs {
+		entry, err := s.entry(ev)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		entrySize := eventBridgeEntrySize(entry)
+		if entrySize > eventBridgeMaxBatchBytes {
+			errs[i] = Permanent(fmt.Errorf("entry of %d bytes exceeds the EventBridge limit of %d bytes", entrySize, eventBridgeMaxBatchBytes))
+			continue
+		}
+		if len(entries) == eventBridgeMaxBatchSize || size+entrySize > eventBridgeMaxBatchBytes {
+			s.putEntries(ctx, entries, index, errs)
+			entries, index, size = entries[:0], index[:0], 0
+		}
+		entries = append(entries, entry)
+		index = append(index, i)
+		size += entrySize
+	}
+	if len(entries) > 0 {
+		s.putEntries(ctx, entries, index, errs)
+	}
+	return errs
+}
+
+// putEntries puts the entries with a single PutEvents request, and sets the errors of the failed ones in errs, at the
+// positions given by index
+func (s *EventBridgeSink) putEntries(ctx context.Context, entries []eventbridgetypes.PutEventsRequestEntry, index []int, errs []error) {
+	out, err := s.svc.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		log.Error().Err(err).Msg("EventBridge Error")
+		for _, i := range index {
+			errs[i] = err
+		}
+		return
+	}
+	for j, res := range out.Entries {
+		if j >= len(index) || res.ErrorCode == nil {
+			continue
+		}
+		code := aws.ToString(res.ErrorCode)
+		err := fmt.Errorf("%s: %s", code, aws.ToString(res.ErrorMessage))
+		switch code {
+		case "ThrottlingException":
+			err = RateLimited(err, 0)
+		case "InternalException", "InternalFailure":
+			// Transient failures of EventBridge, sending the entry again may succeed
+		default:
+			err = Permanent(err)
+		}
+		errs[index[j]] = err
+	}
+}
+
+// eventBridgeEntrySize is the size of the entry counted against the limits of PutEvents: its time, source, detail
+// type and detail. The event bus name does not count.
+func eventBridgeEntrySize(entry eventbridgetypes.PutEventsRequestEntry) int {
+	size := len(aws.ToString(entry.Source)) + len(aws.ToString(entry.DetailType)) + len(aws.ToString(entry.Detail))
+	if entry.Time != nil {
+		size += eventBridgeTimeBytes
+	}
+	return size
+}
+
+// entry builds the PutEvents entry of the event, its detail is rendered from the details layout if any
+func (s *EventBridgeSink) entry(ev *kube.EnhancedEvent) (eventbridgetypes.PutEventsRequestEntry, error) {
 	var toSend string
 	if s.cfg.Details != nil {
 		res, err := convertLayoutTemplate(s.cfg.Details, ev)
 		if err != nil {
-			return err
+			return eventbridgetypes.PutEventsRequestEntry{}, err
 		}
 
 		b, err := json.Marshal(res)
 		toSend = string(b)
 		if err != nil {
-			return err
+			return eventbridgetypes.PutEventsRequestEntry{}, err
 		}
 	} else {
 		toSend = string(ev.ToJSON())
 	}
 	tym := time.Now()
-	inputRequest := eventbridgetypes.PutEventsRequestEntry{
+	return eventbridgetypes.PutEventsRequestEntry{
 		Detail:       aws.String(toSend),
 		DetailType:   aws.String(s.cfg.DetailType),
 		Time:         &tym,
 		Source:       aws.String(s.cfg.Source),
 		EventBusName: aws.String(s.cfg.EventBusName),
-	}
-	log.Info().Str("InputEvent", toSend).Msg("Request")
-
-	_, err := s.svc.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: []eventbridgetypes.PutEventsRequestEntry{inputRequest}})
-	if err != nil {
-		log.Error().Err(err).Msg("EventBridge Error")
-		return err
-	}
-	return nil
+	}, nil
 }
 
 func (s *EventBridgeSink) Close() {
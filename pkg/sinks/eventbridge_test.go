@@ -3,6 +3,7 @@ package sinks
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
@@ -97,3 +98,81 @@ func TestEventBridgeSinkSendPropagatesError(t *testing.T) {
 	err = sink.Send(context.Background(), &kube.EnhancedEvent{Event: corev1.Event{Message: "hello"}})
 	require.ErrorIs(t, err, putErr)
 }
+
+func TestEventBridgeSinkSendBatchClassifiesFailedEntries(t *testing.T) {
+	cfg := &EventBridgeConfig{
+		DetailType:   "deployment",
+		Source:       "cd",
+		EventBusName: "default",
+		Region:       "us-east-1",
+	}
+	evs := []*kube.EnhancedEvent{
+		{Event: corev1.Event{Message: "sent"}},
+		{Event: corev1.Event{Message: "throttled"}},
+		{Event: corev1.Event{Message: "internal"}},
+		{Event: corev1.Event{Message: "rejected"}},
+	}
+	client := &eventbridgeClientMock{
+		putEvents: func(_ context.Context, input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+			require.Len(t, input.Entries, 4)
+			return &eventbridge.PutEventsOutput{
+				FailedEntryCount: 3,
+				Entries: []eventbridgetypes.PutEventsResultEntry{
+					{EventId: aws.String("1")},
+					{ErrorCode: aws.String("ThrottlingException")},
+					{ErrorCode: aws.String("InternalFailure")},
+					{ErrorCode: aws.String("MalformedDetail")},
+				},
+			}, nil
+		},
+	}
+
+	sink, err := newEventBridgeSinkWithClient(cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	require.Len(t, errs, 4)
+	require.NoError(t, errs[0])
+	require.True(t, IsRateLimited(errs[1]))
+	require.Error(t, errs[2])
+	require.False(t, IsPermanent(errs[2]))
+	require.True(t, IsPermanent(errs[3]))
+}
+
+func TestEventBridgeSinkSendBatchSplitsByPayloadSize(t *testing.T) {
+	cfg := &EventBridgeConfig{
+		DetailType:   "deployment",
+		Source:       "cd",
+		EventBusName: "default",
+		Region:       "us-east-1",
+	}
+	large := strings.Repeat("x", 100*1024)
+	evs := []*kube.EnhancedEvent{
+		{Event: corev1.Event{Message: large}},
+		{Event: corev1.Event{Message: strings.Repeat("x", eventBridgeMaxBatchBytes)}},
+		{Event: corev1.Event{Message: large}},
+		{Event: corev1.Event{Message: large}},
+	}
+	var batches []int
+	client := &eventbridgeClientMock{
+		putEvents: func(_ context.Context, input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+			size := 0
+			for _, entry := range input.Entries {
+				size += eventBridgeEntrySize(entry)
+			}
+			require.LessOrEqual(t, size, eventBridgeMaxBatchBytes)
+			batches = append(batches, len(input.Entries))
+			return &eventbridge.PutEventsOutput{Entries: make([]eventbridgetypes.PutEventsResultEntry, len(input.Entries))}, nil
+		},
+	}
+
+	sink, err := newEventBridgeSinkWithClient(cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	// The entry above the limit fails on its own, the others are sent in requests below the limit
+	require.Equal(t, []int{2, 1}, batches)
+	require.Len(t, errs, 4)
+	require.True(t, IsPermanent(errs[1]))
+	for _, i := range []int{0, 2, 3} {
+		require.NoError(t, errs[i])
+	}
+}
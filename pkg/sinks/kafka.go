@@ -110,13 +110,23 @@ func (k *KafkaSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 		toSend = ev.ToJSON()
 	}
 
-	_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: k.cfg.Topic,
-		Key:   sarama.StringEncoder(string(ev.UID)),
-		Value: sarama.ByteEncoder(toSend),
-	})
-
-	return err
+	// The sync producer does not take a context, it is only bounded by the producer timeouts
+	sent := make(chan error, 1)
+	go func() {
+		_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+			Topic: k.cfg.Topic,
+			Key:   sarama.StringEncoder(string(ev.UID)),
+			Value: sarama.ByteEncoder(toSend),
+		})
+		sent <- err
+	}()
+
+	select {
+	case err := <-sent:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close the Kafka producer
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 )
 
 type KinesisConfig struct {
@@ -34,8 +35,18 @@ func NewKinesisSink(cfg *KinesisConfig) (Sink, error) {
 
 type kinesisAPI interface {
 	PutRecord(ctx context.Context, params *kinesis.PutRecordInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error)
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
 }
 
+const (
+	// kinesisMaxBatchSize is the maximum number of records of a PutRecords request
+	kinesisMaxBatchSize = 500
+	// kinesisMaxBatchBytes is the maximum total size of the records of a PutRecords request
+	kinesisMaxBatchBytes = 5 * 1024 * 1024
+	// kinesisMaxRecordBytes is the maximum size of a record, its data along with its partition key
+	kinesisMaxRecordBytes = 1024 * 1024
+)
+
 func buildKinesisClient(ctx context.Context, cfg *KinesisConfig) (kinesisAPI, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("kinesis config is nil")
@@ -87,6 +98,69 @@ func (k *KinesisSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	return err
 }
 
+// SendBatch puts the events with PutRecords, in requests which respect both the limits of the number of records and of
+// their total size. Records which are too large on their own are reported as permanent errors without being sent.
+// Records rejected because the shard throughput is exceeded are reported as rate limited, the other failed records as
+// retryable.
+func (k *KinesisSink) SendBatch(ctx context.Context, evs []*kube.EnhancedEvent) []error {
+	errs := make([]error, len(evs))
+	records := make([]kinesistypes.PutRecordsRequestEntry, 0, min(len(evs), kinesisMaxBatchSize))
+	// index maps the records to their event, as the events which cannot be serialized or are too large are not sent
+	index := make([]int, 0, cap(records))
+	size := 0
+	for i, ev := range evs {
+		toSend, err := serializeEventWithLayout(k.cfg.Layout, ev)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		recordSize := len(toSend) + len(ev.UID)
+		if recordSize > kinesisMaxRecordBytes {
+			errs[i] = Permanent(fmt.Errorf("record of %d bytes exceeds the Kinesis limit of %d bytes", recordSize, kinesisMaxRecordBytes))
+			continue
+		}
+		if len(records) == kinesisMaxBatchSize || size+recordSize > kinesisMaxBatchBytes {
+			k.putRecords(ctx, records, index, errs)
+			records, index, size = records[:0], index[:0], 0
+		}
+		records = append(records, kinesistypes.PutRecordsRequestEntry{
+			Data:         toSend,
+			PartitionKey: aws.String(string(ev.UID)),
+		})
+		index = append(index, i)
+		size += recordSize
+	}
+	if len(records) > 0 {
+		k.putRecords(ctx, records, index, errs)
+	}
+	return errs
+}
+
+// putRecords puts the records with a single PutRecords request, and sets the errors of the failed ones in errs, at the
+// positions given by index
+func (k *KinesisSink) putRecords(ctx context.Context, records []kinesistypes.PutRecordsRequestEntry, index []int, errs []error) {
+	out, err := k.svc.PutRecords(ctx, &kinesis.PutRecordsInput{
+		Records:    records,
+		StreamName: aws.String(k.cfg.StreamName),
+	})
+	if err != nil {
+		for _, i := range index {
+			errs[i] = err
+		}
+		return
+	}
+	for j, rec := range out.Records {
+		if j >= len(index) || rec.ErrorCode == nil {
+			continue
+		}
+		err := fmt.Errorf("%s: %s", aws.ToString(rec.ErrorCode), aws.ToString(rec.ErrorMessage))
+		if aws.ToString(rec.ErrorCode) == "ProvisionedThroughputExceededException" {
+			err = RateLimited(err, 0)
+		}
+		errs[index[j]] = err
+	}
+}
+
 func (k *KinesisSink) Close() {
 	// No-op
 }
@@ -3,11 +3,14 @@ package sinks
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,7 +18,8 @@ import (
 )
 
 type kinesisClientMock struct {
-	putRecord func(ctx context.Context, input *kinesis.PutRecordInput) (*kinesis.PutRecordOutput, error)
+	putRecord  func(ctx context.Context, input *kinesis.PutRecordInput) (*kinesis.PutRecordOutput, error)
+	putRecords func(ctx context.Context, input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error)
 }
 
 func (m *kinesisClientMock) PutRecord(ctx context.Context, input *kinesis.PutRecordInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordOutput, error) {
@@ -26,6 +30,14 @@ func (m *kinesisClientMock) PutRecord(ctx context.Context, input *kinesis.PutRec
 	return m.putRecord(ctx, input)
 }
 
+func (m *kinesisClientMock) PutRecords(ctx context.Context, input *kinesis.PutRecordsInput, _ ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	if m.putRecords == nil {
+		return nil, errors.New("put records not implemented")
+	}
+
+	return m.putRecords(ctx, input)
+}
+
 func TestKinesisSinkSendPublishesRecord(t *testing.T) {
 	ev := &kube.EnhancedEvent{Event: corev1.Event{
 		ObjectMeta: metav1.ObjectMeta{UID: types.UID("uid-1")},
@@ -84,3 +96,71 @@ func TestKinesisSinkSendPropagatesError(t *testing.T) {
 	err = sink.Send(context.Background(), &kube.EnhancedEvent{Event: corev1.Event{Message: "hello"}})
 	require.ErrorIs(t, err, putErr)
 }
+
+func TestKinesisSinkSendBatchReportsFailedRecords(t *testing.T) {
+	cfg := &KinesisConfig{StreamName: "kube-events", Region: "us-east-1"}
+	evs := []*kube.EnhancedEvent{
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-1"}, Message: "sent"}},
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-2"}, Message: "throttled"}},
+		{Event: corev1.Event{ObjectMeta: metav1.ObjectMeta{UID: "uid-3"}, Message: "failed"}},
+	}
+	client := &kinesisClientMock{
+		putRecords: func(_ context.Context, input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+			require.Equal(t, cfg.StreamName, aws.ToString(input.StreamName))
+			require.Len(t, input.Records, 3)
+			require.Equal(t, "uid-2", aws.ToString(input.Records[1].PartitionKey))
+			return &kinesis.PutRecordsOutput{
+				FailedRecordCount: aws.Int32(2),
+				Records: []kinesistypes.PutRecordsResultEntry{
+					{SequenceNumber: aws.String("1")},
+					{ErrorCode: aws.String("ProvisionedThroughputExceededException"), ErrorMessage: aws.String("slow down")},
+					{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("oops")},
+				},
+			}, nil
+		},
+	}
+
+	sink, err := newKinesisSinkWithClient(cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.True(t, IsRateLimited(errs[1]))
+	require.Error(t, errs[2])
+	require.False(t, IsPermanent(errs[2]))
+}
+
+func TestKinesisSinkSendBatchSplitsByPayloadSize(t *testing.T) {
+	cfg := &KinesisConfig{StreamName: "kube-events", Region: "us-east-1"}
+	large := strings.Repeat("x", 900*1024)
+	var evs []*kube.EnhancedEvent
+	for range 6 {
+		evs = append(evs, &kube.EnhancedEvent{Event: corev1.Event{Message: large}})
+	}
+	// A record above the limit fails on its own
+	evs = slices.Insert(evs, 1, &kube.EnhancedEvent{Event: corev1.Event{Message: strings.Repeat("x", kinesisMaxRecordBytes)}})
+	var batches []int
+	client := &kinesisClientMock{
+		putRecords: func(_ context.Context, input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+			size := 0
+			for _, rec := range input.Records {
+				size += len(rec.Data) + len(aws.ToString(rec.PartitionKey))
+			}
+			require.LessOrEqual(t, size, kinesisMaxBatchBytes)
+			batches = append(batches, len(input.Records))
+			return &kinesis.PutRecordsOutput{Records: make([]kinesistypes.PutRecordsResultEntry, len(input.Records))}, nil
+		},
+	}
+
+	sink, err := newKinesisSinkWithClient(cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	require.Equal(t, []int{5, 1}, batches)
+	require.Len(t, errs, 7)
+	require.True(t, IsPermanent(errs[1]))
+	for i, err := range errs {
+		if i != 1 {
+			require.NoError(t, err)
+		}
+	}
+}
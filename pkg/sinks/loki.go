@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -114,7 +113,7 @@ func (l *Loki) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	}
 
 	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-		return errors.New("not successful (2xx) response: " + string(body))
+		return NewHTTPError(resp.StatusCode, resp.Header, body)
 	}
 
 	return nil
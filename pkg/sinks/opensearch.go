@@ -14,7 +14,6 @@ import (
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	opensearch "github.com/opensearch-project/opensearch-go"
 	opensearchapi "github.com/opensearch-project/opensearch-go/opensearchapi"
-	"github.com/rs/zerolog/log"
 )
 
 type OpenSearchConfig struct {
@@ -137,7 +136,7 @@ func (e *OpenSearch) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 		if err != nil {
 			return err
 		}
-		log.Error().Msgf("Indexing failed: %s", string(rb))
+		return NewHTTPError(resp.StatusCode, resp.Header, rb)
 	}
 	return nil
 }
@@ -2,6 +2,9 @@ package sinks
 
 import (
 	"context"
+	"errors"
+	"net/http"
+
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/opsgenie/opsgenie-go-sdk-v2/alert"
 	"github.com/opsgenie/opsgenie-go-sdk-v2/client"
@@ -98,6 +101,10 @@ func (o *OpsgenieSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	}
 
 	_, err = o.alertClient.Create(ctx, &request)
+	var apiErr *client.ApiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		return RateLimited(err, 0)
+	}
 	return err
 }
 
@@ -0,0 +1,122 @@
+package sinks
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+)
+
+const (
+	// DefaultProcessorField is the field which redactions and extractions apply to by default
+	DefaultProcessorField = "message"
+	// DefaultRedactReplacement replaces the redacted parts of a field by default
+	DefaultRedactReplacement = "[REDACTED]"
+)
+
+// ProcessorConfig is a step of a processor chain, which transforms the events before they are routed, or before they
+// are sent to a receiver. Fields are named like in the JSON form of the event, custom fields like "fields.env". A step
+// holds a single operation.
+type ProcessorConfig struct {
+	// Set sets the fields to the values, e.g. "fields.env": "prod"
+	Set map[string]string `yaml:"set"`
+	// Copy sets the fields to the value of another field, e.g. "fields.team": "involvedObject.labels.team". A field
+	// whose source is missing is left unchanged.
+	Copy map[string]string `yaml:"copy"`
+	// Drop removes the fields, or whole maps like "involvedObject.annotations"
+	Drop []string `yaml:"drop"`
+	// Redact replaces the matches of a regular expression in a field
+	Redact *RedactConfig `yaml:"redact"`
+	// Extract sets the named groups of a regular expression matching a field as custom fields
+	Extract *ExtractConfig `yaml:"extract"`
+}
+
+// RedactConfig replaces the matches of the pattern in the field with the replacement, which can refer to the groups of
+// the pattern like "$1"
+type RedactConfig struct {
+	Field       string `yaml:"field"`
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// ExtractConfig matches the pattern against the field and sets every named group which took part in the match as a
+// custom field, e.g. "exit code (?P<exitCode>\d+)" sets "fields.exitCode"
+type ExtractConfig struct {
+	Field   string `yaml:"field"`
+	Pattern string `yaml:"pattern"`
+}
+
+func (c *ProcessorConfig) SetDefaults() {
+	if c.Redact != nil {
+		if c.Redact.Field == "" {
+			c.Redact.Field = DefaultProcessorField
+		}
+		if c.Redact.Replacement == "" {
+			c.Redact.Replacement = DefaultRedactReplacement
+		}
+	}
+	if c.Extract != nil && c.Extract.Field == "" {
+		c.Extract.Field = DefaultProcessorField
+	}
+}
+
+func (c *ProcessorConfig) Validate() error {
+	ops := 0
+	for _, set := range []bool{c.Set != nil, c.Copy != nil, c.Drop != nil, c.Redact != nil, c.Extract != nil} {
+		if set {
+			ops++
+		}
+	}
+	if ops != 1 {
+		return fmt.Errorf("a processor must have exactly one of set, copy, drop, redact or extract, got %d", ops)
+	}
+	for field := range c.Set {
+		if _, err := kube.CompileFieldSetter(field); err != nil {
+			return fmt.Errorf("set: %w", err)
+		}
+	}
+	for field, from := range c.Copy {
+		if _, err := kube.CompileFieldSetter(field); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		if _, err := kube.CompileField(from); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+	}
+	for _, field := range c.Drop {
+		if _, err := kube.CompileFieldDropper(field); err != nil {
+			return fmt.Errorf("drop: %w", err)
+		}
+	}
+	if c.Redact != nil {
+		if _, err := kube.CompileFieldSetter(cmp.Or(c.Redact.Field, DefaultProcessorField)); err != nil {
+			return fmt.Errorf("redact: %w", err)
+		}
+		if _, err := compileProcessorPattern(c.Redact.Pattern); err != nil {
+			return fmt.Errorf("redact: %w", err)
+		}
+	}
+	if c.Extract != nil {
+		if _, err := kube.CompileField(cmp.Or(c.Extract.Field, DefaultProcessorField)); err != nil {
+			return fmt.Errorf("extract: %w", err)
+		}
+		pattern, err := compileProcessorPattern(c.Extract.Pattern)
+		if err != nil {
+			return fmt.Errorf("extract: %w", err)
+		}
+		if !slices.ContainsFunc(pattern.SubexpNames(), func(name string) bool { return name != "" }) {
+			return fmt.Errorf("extract: pattern %q has no named group", c.Extract.Pattern)
+		}
+	}
+	return nil
+}
+
+func compileProcessorPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("pattern must be set")
+	}
+	return regexp.Compile(pattern)
+}
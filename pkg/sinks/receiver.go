@@ -1,6 +1,12 @@
 package sinks
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/spool"
+)
 
 // Receiver allows receiving
 type ReceiverConfig struct {
@@ -25,10 +31,117 @@ type ReceiverConfig struct {
 	BigQuery      *BigQueryConfig      `yaml:"bigquery"`
 	EventBridge   *EventBridgeConfig   `yaml:"eventbridge"`
 	Pipe          *PipeConfig          `yaml:"pipe"`
-	Name          string               `yaml:"name"`
+	// Spool enables the on-disk write-ahead log so undelivered events survive restarts and sink outages
+	Spool *spool.Config `yaml:"spool"`
+	Name  string        `yaml:"name"`
+	Queue QueueConfig   `yaml:"queue"`
+	// Retry enables sending an event again after a retryable error, by default it is attempted only once
+	Retry *RetryConfig `yaml:"retry"`
+	// CircuitBreaker stops calling the sink while it keeps failing
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuitBreaker"`
+	// RateLimit bounds the rate of events sent to the sink
+	RateLimit *RateLimitConfig `yaml:"rateLimit"`
+	// Batch sends the events in batches to sinks which support it, other sinks get them one by one
+	Batch *BatchConfig `yaml:"batch"`
+	// Dedup suppresses the repeats of the events sent to the receiver
+	Dedup *DedupConfig `yaml:"dedup"`
+	// Group sends the events to the receiver in notifications of grouped events
+	Group *GroupConfig `yaml:"group"`
+	// Processors transform the events sent to the receiver, after the global processors
+	Processors []ProcessorConfig `yaml:"processors"`
+	// Timeout bounds every attempt to send an event to the sink, zero means no limit
+	Timeout time.Duration `yaml:"timeout"`
+	// Concurrency is the number of workers sending events to the sink, which must be safe for concurrent use when
+	// it is more than one. Events of the same involved object are always sent by the same worker.
+	Concurrency int `yaml:"concurrency"`
+	// DeadLetter names the receiver which gets the events this receiver ultimately fails to deliver
+	DeadLetter string `yaml:"deadLetter"`
+}
+
+func (r *ReceiverConfig) SetDefaults() {
+	r.Queue.SetDefaults()
+	if r.Concurrency == 0 {
+		r.Concurrency = 1
+	}
+	if r.Spool != nil {
+		r.Spool.SetDefaults()
+	}
+	if r.Retry != nil {
+		r.Retry.SetDefaults()
+	}
+	if r.CircuitBreaker != nil {
+		r.CircuitBreaker.SetDefaults()
+	}
+	if r.RateLimit != nil {
+		r.RateLimit.SetDefaults()
+	}
+	if r.Batch != nil {
+		r.Batch.SetDefaults()
+	}
+	if r.Dedup != nil {
+		r.Dedup.SetDefaults()
+	}
+	if r.Group != nil {
+		r.Group.SetDefaults()
+	}
+	for i := range r.Processors {
+		r.Processors[i].SetDefaults()
+	}
 }
 
 func (r *ReceiverConfig) Validate() error {
+	if r.Name == "" {
+		return errors.New("receiver name must be set")
+	}
+	if r.Timeout < 0 {
+		return fmt.Errorf("receiver %q: timeout must not be negative, got %s", r.Name, r.Timeout)
+	}
+	if r.Concurrency < 0 {
+		return fmt.Errorf("receiver %q: concurrency must not be negative, got %d", r.Name, r.Concurrency)
+	}
+	if err := r.Queue.Validate(); err != nil {
+		return fmt.Errorf("receiver %q: %w", r.Name, err)
+	}
+	if r.Spool != nil {
+		if err := r.Spool.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.Retry != nil {
+		if err := r.Retry.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.CircuitBreaker != nil {
+		if err := r.CircuitBreaker.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.RateLimit != nil {
+		if err := r.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.Batch != nil {
+		if err := r.Batch.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.Dedup != nil {
+		if err := r.Dedup.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	if r.Group != nil {
+		if err := r.Group.Validate(); err != nil {
+			return fmt.Errorf("receiver %q: %w", r.Name, err)
+		}
+	}
+	for i := range r.Processors {
+		if err := r.Processors[i].Validate(); err != nil {
+			return fmt.Errorf("receiver %q: processors[%d]: %w", r.Name, i, err)
+		}
+	}
 	return nil
 }
 
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/metrics"
 )
 
 // Sink is the interface that the third-party providers should implement. It should just get the event and
@@ -19,11 +21,34 @@ type Sink interface {
 	Close()
 }
 
-// BatchSink is an extension Sink that can handle batch events.
-// NOTE: Currently no provider implements it nor the receivers can handle it.
+// Flusher is implemented by sinks which buffer events. On shutdown, the registry flushes them before calling Close,
+// and Flush returns the number of buffered events which could not be delivered before ctx was done.
+type Flusher interface {
+	Flush(ctx context.Context) int
+}
+
+// Instrumented is implemented by sinks which export metrics of their own. The registry hands them its metrics store
+// on registration, together with the name of the receiver to label the metrics with.
+type Instrumented interface {
+	SetMetricsStore(store *metrics.Store, receiver string)
+}
+
+// BatchSink is an extension Sink that can handle batch events. Receivers with batching configured gather the events
+// and call SendBatch instead of Send. It returns one result per event, in the same order, so a partial failure only
+// retries or dead-letters the events which were not accepted.
 type BatchSink interface {
 	Sink
-	SendBatch([]*kube.EnhancedEvent) error
+	SendBatch(ctx context.Context, evs []*kube.EnhancedEvent) []error
+}
+
+// sendChunks splits the events into chunks of at most size events, which is the limit of the provider API, and
+// collects the results of send for every chunk
+func sendChunks(evs []*kube.EnhancedEvent, size int, send func(chunk []*kube.EnhancedEvent) []error) []error {
+	errs := make([]error, 0, len(evs))
+	for chunk := range slices.Chunk(evs, size) {
+		errs = append(errs, send(chunk)...)
+	}
+	return errs
 }
 
 type TLS struct {
@@ -2,6 +2,7 @@ package sinks
 
 import (
 	"context"
+	"errors"
 	"sort"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
@@ -96,6 +97,10 @@ func (s *SlackSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 
 	_ch, _ts, _text, err := s.client.SendMessageContext(ctx, channel, options...)
 	log.Debug().Str("ch", _ch).Str("ts", _ts).Str("text", _text).Err(err).Msg("Slack Response")
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return RateLimited(err, rateLimited.RetryAfter)
+	}
 	return err
 }
 
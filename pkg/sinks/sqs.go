@@ -3,11 +3,13 @@ package sinks
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
 type SQSConfig struct {
@@ -26,8 +28,16 @@ type SQSSink struct {
 type sqsAPI interface {
 	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
 	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
 }
 
+const (
+	// sqsMaxBatchSize is the maximum number of messages of a SendMessageBatch request
+	sqsMaxBatchSize = 10
+	// sqsMaxBatchBytes is the maximum total size of the messages of a SendMessageBatch request, and so of a message
+	sqsMaxBatchBytes = 256 * 1024
+)
+
 func NewSQSSink(cfg *SQSConfig) (Sink, error) {
 	ctx := context.Background()
 	svc, err := buildSQSClient(ctx, cfg)
@@ -101,6 +111,67 @@ func (s *SQSSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	return err
 }
 
+// SendBatch sends the events with SendMessageBatch, in requests which respect both the limits of the number of
+// messages and of their total size. Messages which failed because of the sender, e.g. because they are too large, are
+// reported as permanent errors, the other failed messages as retryable.
+func (s *SQSSink) SendBatch(ctx context.Context, evs []*kube.EnhancedEvent) []error {
+	errs := make([]error, len(evs))
+	entries := make([]sqstypes.SendMessageBatchRequestEntry, 0, min(len(evs), sqsMaxBatchSize))
+	size := 0
+	for i, ev := range evs {
+		toSend, err := serializeEventWithLayout(s.cfg.Layout, ev)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		if len(toSend) > sqsMaxBatchBytes {
+			errs[i] = Permanent(fmt.Errorf("message of %d bytes exceeds the SQS limit of %d bytes", len(toSend), sqsMaxBatchBytes))
+			continue
+		}
+		if len(entries) == sqsMaxBatchSize || size+len(toSend) > sqsMaxBatchBytes {
+			s.sendEntries(ctx, entries, errs)
+			entries, size = entries[:0], 0
+		}
+		// The ids are the positions in the batch, so the failed entries can be matched to their event
+		entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(string(toSend)),
+		})
+		size += len(toSend)
+	}
+	if len(entries) > 0 {
+		s.sendEntries(ctx, entries, errs)
+	}
+	return errs
+}
+
+// sendEntries sends the entries with a single SendMessageBatch request, and sets the errors of the failed ones in
+// errs, at the positions of their ids
+func (s *SQSSink) sendEntries(ctx context.Context, entries []sqstypes.SendMessageBatchRequestEntry, errs []error) {
+	out, err := s.svc.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		Entries:  entries,
+		QueueUrl: aws.String(s.queueURL),
+	})
+	if err != nil {
+		for _, entry := range entries {
+			i, _ := strconv.Atoi(aws.ToString(entry.Id))
+			errs[i] = err
+		}
+		return
+	}
+	for _, failed := range out.Failed {
+		i, convErr := strconv.Atoi(aws.ToString(failed.Id))
+		if convErr != nil || i < 0 || i >= len(errs) {
+			continue
+		}
+		err := fmt.Errorf("%s: %s", aws.ToString(failed.Code), aws.ToString(failed.Message))
+		if failed.SenderFault {
+			err = Permanent(err)
+		}
+		errs[i] = err
+	}
+}
+
 func (s *SQSSink) Close() {
 	// No-op
 }
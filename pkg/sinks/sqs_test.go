@@ -3,11 +3,13 @@ package sinks
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -15,6 +17,7 @@ import (
 type sqsClientMock struct {
 	getQueueUrl func(ctx context.Context, input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error)
 	sendMessage func(ctx context.Context, input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error)
+	sendBatch   func(ctx context.Context, input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error)
 }
 
 func (m *sqsClientMock) GetQueueUrl(ctx context.Context, input *sqs.GetQueueUrlInput, _ ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
@@ -31,6 +34,13 @@ func (m *sqsClientMock) SendMessage(ctx context.Context, input *sqs.SendMessageI
 	return m.sendMessage(ctx, input)
 }
 
+func (m *sqsClientMock) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	if m.sendBatch == nil {
+		return nil, errors.New("send message batch not implemented")
+	}
+	return m.sendBatch(ctx, input)
+}
+
 func TestNewSQSSinkResolvesQueueURL(t *testing.T) {
 	cfg := &SQSConfig{QueueName: "events", Region: "us-east-1"}
 	client := &sqsClientMock{
@@ -103,3 +113,80 @@ func TestSQSSinkSendPropagatesError(t *testing.T) {
 	err = sink.Send(context.Background(), &kube.EnhancedEvent{Event: corev1.Event{Message: "hello"}})
 	require.ErrorIs(t, err, sendErr)
 }
+
+func TestSQSSinkSendBatchSplitsAndReportsFailedMessages(t *testing.T) {
+	cfg := &SQSConfig{QueueName: "events", Region: "us-east-1"}
+	evs := make([]*kube.EnhancedEvent, 12)
+	for i := range evs {
+		evs[i] = &kube.EnhancedEvent{Event: corev1.Event{Message: "hello"}}
+	}
+	var batches []int
+	client := &sqsClientMock{}
+	client.getQueueUrl = func(_ context.Context, _ *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("http://queue-url")}, nil
+	}
+	client.sendBatch = func(_ context.Context, input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+		require.Equal(t, "http://queue-url", aws.ToString(input.QueueUrl))
+		batches = append(batches, len(input.Entries))
+		if len(batches) > 1 {
+			return &sqs.SendMessageBatchOutput{}, nil
+		}
+		return &sqs.SendMessageBatchOutput{
+			Failed: []sqstypes.BatchResultErrorEntry{
+				{Id: input.Entries[1].Id, Code: aws.String("InvalidMessageContents"), SenderFault: true},
+				{Id: input.Entries[2].Id, Code: aws.String("InternalError")},
+			},
+		}, nil
+	}
+
+	sink, err := newSQSSinkWithClient(context.Background(), cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	require.Equal(t, []int{10, 2}, batches)
+	require.Len(t, errs, 12)
+	require.NoError(t, errs[0])
+	require.True(t, IsPermanent(errs[1]))
+	require.Error(t, errs[2])
+	require.False(t, IsPermanent(errs[2]))
+	for _, err := range errs[3:] {
+		require.NoError(t, err)
+	}
+}
+
+func TestSQSSinkSendBatchSplitsByPayloadSize(t *testing.T) {
+	cfg := &SQSConfig{QueueName: "events", Region: "us-east-1"}
+	large := strings.Repeat("x", 100*1024)
+	evs := []*kube.EnhancedEvent{
+		{Event: corev1.Event{Message: large}},
+		{Event: corev1.Event{Message: strings.Repeat("x", sqsMaxBatchBytes)}},
+		{Event: corev1.Event{Message: large}},
+		{Event: corev1.Event{Message: large}},
+	}
+	var batches [][]string
+	client := &sqsClientMock{}
+	client.getQueueUrl = func(_ context.Context, _ *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+		return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("http://queue-url")}, nil
+	}
+	client.sendBatch = func(_ context.Context, input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+		ids := make([]string, 0, len(input.Entries))
+		size := 0
+		for _, entry := range input.Entries {
+			ids = append(ids, aws.ToString(entry.Id))
+			size += len(aws.ToString(entry.MessageBody))
+		}
+		require.LessOrEqual(t, size, sqsMaxBatchBytes)
+		batches = append(batches, ids)
+		return &sqs.SendMessageBatchOutput{}, nil
+	}
+
+	sink, err := newSQSSinkWithClient(context.Background(), cfg, client)
+	require.NoError(t, err)
+	errs := sink.(BatchSink).SendBatch(context.Background(), evs)
+	// The message above the limit fails on its own, the others are sent in batches below the limit
+	require.Equal(t, [][]string{{"0", "2"}, {"3"}}, batches)
+	require.Len(t, errs, 4)
+	require.True(t, IsPermanent(errs[1]))
+	for _, i := range []int{0, 2, 3} {
+		require.NoError(t, errs[i])
+	}
+}
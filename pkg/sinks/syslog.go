@@ -3,8 +3,10 @@ package sinks
 import (
 	"context"
 	"encoding/json"
-	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"io"
 	"log/syslog"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 )
 
 type SyslogConfig struct {
@@ -14,7 +16,7 @@ type SyslogConfig struct {
 }
 
 type SyslogSink struct {
-	sw *syslog.Writer
+	sw io.WriteCloser
 }
 
 func NewSyslogSink(config *SyslogConfig) (Sink, error) {
@@ -30,15 +32,23 @@ func (w *SyslogSink) Close() {
 }
 
 func (w *SyslogSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
 
-	if b, err := json.Marshal(ev); err == nil {
-		_, writeErr := w.sw.Write(b)
+	// The syslog writer does not take a context nor expose its connection, so a write to a hung peer is abandoned once
+	// ctx is done
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.sw.Write(b)
+		written <- err
+	}()
 
-		if writeErr != nil {
-			return writeErr
-		}
-	} else {
+	select {
+	case err := <-written:
 		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
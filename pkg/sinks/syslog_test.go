@@ -0,0 +1,36 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
+	"github.com/stretchr/testify/assert"
+)
+
+// hungWriter blocks every write until it is released, like a syslog peer which stopped reading
+type hungWriter struct {
+	release chan struct{}
+}
+
+func (w *hungWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func (w *hungWriter) Close() error {
+	return nil
+}
+
+func TestSyslog_Send_HonorsContext(t *testing.T) {
+	w := &hungWriter{release: make(chan struct{})}
+	defer close(w.release)
+	sink := &SyslogSink{sw: w}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := sink.Send(ctx, &kube.EnhancedEvent{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
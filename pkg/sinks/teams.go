@@ -48,7 +48,7 @@ func (w *Teams) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, w.cfg.Endpoint, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.Endpoint, bytes.NewReader(reqBody))
 	if err != nil {
 		return err
 	}
@@ -59,7 +59,7 @@ func (w *Teams) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	defer resp.Body.Close()
@@ -71,11 +71,11 @@ func (w *Teams) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("not 200: %s", message)
+		return NewHTTPError(resp.StatusCode, resp.Header, body)
 	}
 	// see: https://learn.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/connectors-using?tabs=cURL#rate-limiting-for-connectors
 	if strings.Contains(message, "Microsoft Teams endpoint returned HTTP error 429") {
-		return fmt.Errorf("rate limited: %s", message)
+		return RateLimited(fmt.Errorf("rate limited: %s", message), 0)
 	}
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/DavidHernandez21/kubernetes-event-exporter/pkg/kube"
 	"github.com/stretchr/testify/assert"
@@ -33,4 +34,21 @@ func TestTeams_Send_WhenTeamsReturnsRateLimited(t *testing.T) {
 	err := client.Send(context.Background(), &kube.EnhancedEvent{})
 
 	assert.ErrorContains(t, err, "rate limited")
+	assert.True(t, IsRateLimited(err))
+}
+
+func TestTeams_Send_HonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	client := Teams{cfg: &TeamsConfig{Endpoint: ts.URL}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := client.Send(ctx, &kube.EnhancedEvent{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
 }
@@ -10,6 +10,16 @@ import (
 	"github.com/Masterminds/sprig/v3"
 )
 
+// groupData is what the templates of a group notification are rendered with: the latest event of the group, along with
+// the events it lists, the values of its grouping fields and the number of events, including the omitted ones. Count
+// hides the count of the latest event, which is still available as .Event.Count.
+type groupData struct {
+	*kube.EnhancedEvent
+	GroupLabels map[string]string
+	Events      []kube.EnhancedEvent
+	Count       int
+}
+
 func GetString(event *kube.EnhancedEvent, text string) (string, error) {
 	tmpl, err := template.New("template").Funcs(sprig.TxtFuncMap()).Parse(text)
 	if err != nil {
@@ -17,8 +27,16 @@ func GetString(event *kube.EnhancedEvent, text string) (string, error) {
 	}
 
 	buf := new(bytes.Buffer)
-	// TODO: Should we send event directly or more events?
-	err = tmpl.Execute(buf, event)
+	var data any = event
+	if event != nil && event.Group != nil {
+		data = groupData{
+			EnhancedEvent: event,
+			Events:        event.Group.Events,
+			GroupLabels:   event.Group.Labels,
+			Count:         len(event.Group.Events) + event.Group.Omitted,
+		}
+	}
+	err = tmpl.Execute(buf, data)
 	if err != nil {
 		return "", err
 	}
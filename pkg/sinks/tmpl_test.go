@@ -50,3 +50,31 @@ func TestLayoutConvert(t *testing.T) {
 
 	require.Equal(t, val2, ev.Message)
 }
+
+func TestGetString_Group(t *testing.T) {
+	ev := &kube.EnhancedEvent{}
+	ev.Message = "Back-off restarting failed container"
+	ev.Count = 7
+	first, second := *ev, *ev
+	first.InvolvedObject.Name = "nginx-1"
+	second.InvolvedObject.Name = "nginx-2"
+	ev.Group = &kube.Group{
+		Labels: map[string]string{"namespace": "default"},
+		Events: []kube.EnhancedEvent{first, second},
+	}
+
+	s, err := GetString(ev, `{{ .Count }} events in {{ .GroupLabels.namespace }}:{{ range .Events }} {{ .InvolvedObject.Name }}{{ end }} ({{ .Event.Count }}x {{ .Message }})`)
+	require.NoError(t, err)
+	require.Equal(t, "2 events in default: nginx-1 nginx-2 (7x Back-off restarting failed container)", s)
+
+	// The omitted events are counted
+	ev.Group.Omitted = 3
+	s, err = GetString(ev, "{{ .Count }} events, {{ len .Events }} listed")
+	require.NoError(t, err)
+	require.Equal(t, "5 events, 2 listed", s)
+
+	ev.Group = nil
+	s, err = GetString(ev, "{{ .Count }}")
+	require.NoError(t, err)
+	require.Equal(t, "7", s)
+}
@@ -3,7 +3,6 @@ package sinks
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -45,7 +44,7 @@ func (w *Webhook) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, w.cfg.Endpoint, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.Endpoint, bytes.NewReader(reqBody))
 	if err != nil {
 		return err
 	}
@@ -62,8 +61,7 @@ func (w *Webhook) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 		}
 	}
 
-	client := http.DefaultClient
-	client.Transport = w.transport
+	client := &http.Client{Transport: w.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -76,7 +74,7 @@ func (w *Webhook) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
 	}
 
 	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-		return errors.New("not successful (2xx) response: " + string(body))
+		return NewHTTPError(resp.StatusCode, resp.Header, body)
 	}
 
 	return nil
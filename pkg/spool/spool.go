@@ -0,0 +1,516 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+
+	DefaultSegmentSize   = 16 << 20
+	DefaultMaxSize       = 256 << 20
+	DefaultFsyncInterval = time.Second
+
+	segmentExt  = ".seg"
+	ackFileName = "ack"
+	headerSize  = 16
+)
+
+// Config configures the write-ahead spool of a receiver. Events are appended to segment files in Dir and only
+// removed once the sink acknowledged them, so they survive restarts and sink outages.
+type Config struct {
+	// Dir is the base directory. Each receiver gets its own sub directory.
+	Dir string `yaml:"dir"`
+	// Fsync is one of always, interval (default) or never.
+	Fsync string `yaml:"fsync"`
+	// FsyncInterval is the period of the background fsync when Fsync is interval.
+	FsyncInterval time.Duration `yaml:"fsyncInterval"`
+	// SegmentSize is the size in bytes after which a new segment file is started.
+	SegmentSize int64 `yaml:"segmentSize"`
+	// MaxSize is the total size in bytes of all segments. The oldest segments are discarded above it.
+	MaxSize int64 `yaml:"maxSize"`
+	// MaxAge discards segments which were last written before it. Zero means no limit.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+func (c *Config) SetDefaults() {
+	if c.Fsync == "" {
+		c.Fsync = FsyncInterval
+	}
+	if c.FsyncInterval == 0 {
+		c.FsyncInterval = DefaultFsyncInterval
+	}
+	if c.SegmentSize == 0 {
+		c.SegmentSize = DefaultSegmentSize
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Dir == "" {
+		return errors.New("spool.dir must be set")
+	}
+	switch c.Fsync {
+	case "", FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return fmt.Errorf("spool.fsync must be one of always, interval or never, got %q", c.Fsync)
+	}
+	if c.FsyncInterval < 0 || c.SegmentSize < 0 || c.MaxSize < 0 || c.MaxAge < 0 {
+		return errors.New("spool sizes and durations must not be negative")
+	}
+	if c.MaxSize < c.SegmentSize {
+		return fmt.Errorf("spool.maxSize (%d) must not be smaller than spool.segmentSize (%d)", c.MaxSize, c.SegmentSize)
+	}
+	return nil
+}
+
+// Record is an entry of the spool which was not acknowledged yet.
+type Record struct {
+	Data []byte
+	Seq  uint64
+}
+
+type segment struct {
+	modTime  time.Time
+	path     string
+	firstSeq uint64
+	lastSeq  uint64
+	size     int64
+}
+
+// Spool is a segmented append-only log. Each appended record gets a monotonically increasing sequence number
+// and a record is considered delivered once it and all the records before it are acknowledged. Only this
+// watermark is persisted, so on restart every record after it is replayed, which gives at-least-once delivery.
+type Spool struct {
+	active    *os.File
+	writer    *bufio.Writer
+	acked     map[uint64]struct{}
+	stop      chan struct{}
+	stopOnce  sync.Once
+	dir       string
+	pending   []Record
+	segments  []*segment
+	cfg       Config
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	committed uint64
+	nextSeq   uint64
+	dropped   uint64
+	totalSize int64
+	dirty     bool
+}
+
+// Open opens or creates the spool in dir and loads the records which were not acknowledged before.
+func Open(dir string, cfg Config) (*Spool, error) {
+	cfg.SetDefaults()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("cannot create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		cfg:   cfg,
+		dir:   dir,
+		acked: make(map[uint64]struct{}),
+		stop:  make(chan struct{}),
+	}
+
+	if err := s.readAck(); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.openActive(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Fsync != FsyncAlways {
+		s.wg.Go(s.syncLoop)
+	}
+	return s, nil
+}
+
+// Pending returns the records which were in the spool but not acknowledged when it was opened. They should be
+// delivered before any newly appended record.
+func (s *Spool) Pending() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pending
+	s.pending = nil
+	return p
+}
+
+// Append writes data to the active segment and returns its sequence number.
+func (s *Spool) Append(data []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return 0, errors.New("spool is closed")
+	}
+
+	seq := s.nextSeq
+	var header [headerSize]byte
+	binary.BigEndian.PutUint64(header[0:8], seq)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[12:16], crc32.ChecksumIEEE(data))
+
+	if _, err := s.writer.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return 0, err
+	}
+	if s.cfg.Fsync == FsyncAlways {
+		if err := s.flushActive(true); err != nil {
+			return 0, err
+		}
+	}
+
+	s.nextSeq++
+	n := int64(headerSize + len(data))
+	cur := s.segments[len(s.segments)-1]
+	if cur.firstSeq == 0 {
+		cur.firstSeq = seq
+	}
+	cur.lastSeq = seq
+	cur.size += n
+	cur.modTime = time.Now()
+	s.totalSize += n
+
+	if cur.size >= s.cfg.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return seq, err
+		}
+	}
+	s.enforceLimits()
+	return seq, nil
+}
+
+// Ack marks the record as delivered. Segments which only contain delivered records are removed.
+func (s *Spool) Ack(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq <= s.committed || seq >= s.nextSeq {
+		return nil
+	}
+	s.acked[seq] = struct{}{}
+
+	advanced := false
+	for {
+		if _, ok := s.acked[s.committed+1]; !ok {
+			break
+		}
+		delete(s.acked, s.committed+1)
+		s.committed++
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+
+	s.dirty = true
+	s.removeDelivered()
+	if s.cfg.Fsync == FsyncAlways {
+		return s.writeAck(true)
+	}
+	return nil
+}
+
+// Depth returns the number of records which are not acknowledged yet.
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.nextSeq-1-s.committed) - len(s.acked)
+}
+
+// Dropped returns the number of records discarded because of the size or age limits.
+func (s *Spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close flushes the active segment and the acknowledgement watermark to disk. Closing it again does nothing.
+func (s *Spool) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+
+	err := s.flushActive(s.cfg.Fsync != FsyncNever)
+	if closeErr := s.active.Close(); err == nil {
+		err = closeErr
+	}
+	s.active = nil
+	if ackErr := s.writeAck(s.cfg.Fsync != FsyncNever); err == nil {
+		err = ackErr
+	}
+	return err
+}
+
+func (s *Spool) syncLoop() {
+	ticker := time.NewTicker(s.cfg.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.active != nil {
+				fsync := s.cfg.Fsync == FsyncInterval
+				if err := s.flushActive(fsync); err != nil {
+					log.Error().Err(err).Str("dir", s.dir).Msg("Cannot flush spool segment")
+				}
+				if s.dirty {
+					if err := s.writeAck(fsync); err != nil {
+						log.Error().Err(err).Str("dir", s.dir).Msg("Cannot persist spool acknowledgements")
+					}
+				}
+				s.enforceLimits()
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Spool) flushActive(fsync bool) error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if fsync {
+		return s.active.Sync()
+	}
+	return nil
+}
+
+func (s *Spool) rotate() error {
+	if err := s.flushActive(s.cfg.Fsync != FsyncNever); err != nil {
+		return err
+	}
+	if err := s.active.Close(); err != nil {
+		return err
+	}
+	return s.openActive()
+}
+
+// openActive starts a new segment named after the next sequence number.
+func (s *Spool) openActive() error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("cannot open spool segment: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.active = f
+	s.writer = bufio.NewWriter(f)
+	s.segments = append(s.segments, &segment{path: path, size: info.Size(), modTime: time.Now()})
+	s.totalSize += info.Size()
+	return nil
+}
+
+// removeDelivered deletes the closed segments whose records are all acknowledged.
+func (s *Spool) removeDelivered() {
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		if seg.lastSeq > s.committed {
+			return
+		}
+		s.removeFirst()
+	}
+}
+
+// enforceLimits discards the oldest closed segments while the spool is over MaxSize or they are older than MaxAge.
+func (s *Spool) enforceLimits() {
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		expired := s.cfg.MaxAge > 0 && time.Since(seg.modTime) > s.cfg.MaxAge
+		if s.totalSize <= s.cfg.MaxSize && !expired {
+			return
+		}
+
+		if seg.lastSeq > s.committed {
+			lost := seg.lastSeq - s.committed
+			for seq := range s.acked {
+				if seq <= seg.lastSeq {
+					delete(s.acked, seq)
+					lost--
+				}
+			}
+			s.dropped += lost
+			s.committed = seg.lastSeq
+			s.dirty = true
+			log.Warn().Str("dir", s.dir).Uint64("records", lost).Bool("expired", expired).Msg("Discarding undelivered spool segment")
+		}
+		s.removeFirst()
+	}
+}
+
+func (s *Spool) removeFirst() {
+	seg := s.segments[0]
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Err(err).Str("segment", seg.path).Msg("Cannot remove spool segment")
+	}
+	s.totalSize -= seg.size
+	s.segments = s.segments[1:]
+}
+
+func (s *Spool) readAck() error {
+	b, err := os.ReadFile(filepath.Join(s.dir, ackFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read spool acknowledgements: %w", err)
+	}
+
+	committed, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("corrupted spool acknowledgements file: %w", err)
+	}
+	s.committed = committed
+	return nil
+}
+
+// writeAck persists the watermark atomically by writing a temporary file and renaming it.
+func (s *Spool) writeAck(fsync bool) error {
+	path := filepath.Join(s.dir, ackFileName)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(s.committed, 10)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// load reads all segments in order. Records up to the watermark are skipped and the remaining ones are kept
+// for replay. A torn write at the end of a segment is truncated.
+func (s *Spool) load() error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	s.nextSeq = s.committed + 1
+	for _, path := range matches {
+		seg, records, err := s.readSegment(path)
+		if err != nil {
+			return err
+		}
+		if seg.lastSeq == 0 || seg.lastSeq <= s.committed {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("cannot remove spool segment: %w", err)
+			}
+			continue
+		}
+
+		s.segments = append(s.segments, seg)
+		s.totalSize += seg.size
+		s.pending = append(s.pending, records...)
+		s.nextSeq = max(s.nextSeq, seg.lastSeq+1)
+	}
+	return nil
+}
+
+func (s *Spool) readSegment(path string) (*segment, []Record, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seg := &segment{path: path, modTime: info.ModTime()}
+	var records []Record
+	r := bufio.NewReader(f)
+	for {
+		var header [headerSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		seq := binary.BigEndian.Uint64(header[0:8])
+		// The length is checked against the rest of the file before it is allocated, a corrupted header would
+		// allocate up to 4GiB otherwise
+		length := int64(binary.BigEndian.Uint32(header[8:12]))
+		if length > info.Size()-seg.size-headerSize {
+			break
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[12:16]) {
+			break
+		}
+
+		if seg.firstSeq == 0 {
+			seg.firstSeq = seq
+		}
+		seg.lastSeq = seq
+		seg.size += int64(headerSize + len(data))
+		if seq > s.committed {
+			records = append(records, Record{Seq: seq, Data: data})
+		}
+	}
+
+	if seg.size < info.Size() {
+		log.Warn().Str("segment", path).Int64("offset", seg.size).Msg("Truncating corrupted spool segment")
+		if err := f.Truncate(seg.size); err != nil {
+			return nil, nil, fmt.Errorf("cannot truncate spool segment: %w", err)
+		}
+	}
+	return seg, records, nil
+}
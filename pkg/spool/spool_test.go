@@ -0,0 +1,149 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestSpool(t *testing.T, dir string, cfg Config) *Spool {
+	t.Helper()
+	s, err := Open(dir, cfg)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSpool_ReplaysUnacknowledgedRecords(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+
+	for _, v := range []string{"a", "b", "c"} {
+		_, err := s.Append([]byte(v))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Ack(1))
+	require.NoError(t, s.Ack(3))
+	assert.Equal(t, 1, s.Depth())
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+
+	s = openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+	defer s.Close()
+
+	// Only the watermark is persisted, so "c" is delivered again after "b"
+	pending := s.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, Record{Seq: 2, Data: []byte("b")}, pending[0])
+	assert.Equal(t, Record{Seq: 3, Data: []byte("c")}, pending[1])
+	assert.Empty(t, s.Pending())
+
+	seq, err := s.Append([]byte("d"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), seq)
+}
+
+func TestSpool_RemovesDeliveredSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncNever, SegmentSize: 20})
+	defer s.Close()
+
+	for range 4 {
+		_, err := s.Append([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Len(t, segments, 5)
+
+	for seq := uint64(1); seq <= 4; seq++ {
+		require.NoError(t, s.Ack(seq))
+	}
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Len(t, segments, 1)
+	assert.Equal(t, 0, s.Depth())
+}
+
+func TestSpool_EnforcesMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncNever, SegmentSize: 26, MaxSize: 52})
+
+	for range 4 {
+		_, err := s.Append([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, uint64(2), s.Dropped())
+	assert.Equal(t, 2, s.Depth())
+	require.NoError(t, s.Close())
+
+	s = openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncNever, SegmentSize: 26, MaxSize: 52})
+	defer s.Close()
+	pending := s.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, uint64(3), pending[0].Seq)
+}
+
+func TestSpool_TruncatesTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+	_, err := s.Append([]byte("complete"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NotEmpty(t, segments)
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+	defer s.Close()
+	pending := s.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, []byte("complete"), pending[0].Data)
+
+	info, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	assert.Equal(t, int64(headerSize+len("complete")), info.Size())
+}
+
+func TestSpool_TruncatesCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+	_, err := s.Append([]byte("complete"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NotEmpty(t, segments)
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	// A full header whose length is far beyond the end of the segment
+	_, err = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 2, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 'x'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = openTestSpool(t, dir, Config{Dir: dir, Fsync: FsyncAlways})
+	defer s.Close()
+	pending := s.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, []byte("complete"), pending[0].Data)
+
+	info, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	assert.Equal(t, int64(headerSize+len("complete")), info.Size())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.Error(t, (&Config{}).Validate())
+	assert.Error(t, (&Config{Dir: "/tmp", Fsync: "sometimes"}).Validate())
+	assert.Error(t, (&Config{Dir: "/tmp", SegmentSize: 10, MaxSize: 5}).Validate())
+
+	cfg := Config{Dir: "/tmp"}
+	cfg.SetDefaults()
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, FsyncInterval, cfg.Fsync)
+}